@@ -26,6 +26,47 @@ func main() {{ "Example" | code }}
 
 Full documentation is available on [GoDoc](http://godoc.org/github.com/bsm/redis-lock)
 
+## Sharded clients
+
+`redis.Ring` and `redis.ClusterClient` are supported. Options which use companion keys
+(`MaxQueueDepth`, `Audit`, `Heartbeat`) require keys with a hash tag, e.g. `{orders:123}`,
+so that all keys of a lock map to the same shard (see `KeyBuilder.HashTag`).
+`HolderID` tracking is not available with sharded clients.
+
+## Redis without EVAL
+
+Some managed Redis offerings reject `EVAL`. Build with the `nolua` tag to replace the
+scripts with plain `SET NX`/`GET`/`DEL`/`PEXPIRE` commands:
+
+    go build -tags nolua ./...
+
+Ownership checks on refresh and release are then no longer atomic: if a lock expires
+between `GET` and `DEL`, its previous holder may release the lock of its successor.
+Features which depend on scripts (queues, holder tracking, audit, ...) fail with
+`ErrScriptsDisabled`. Ginkgo and Gomega are only imported by tests and never compiled
+into binaries.
+
+## AWS ElastiCache and MemoryDB
+
+Use `NewElastiCacheClient` with the configuration endpoint of a cluster-mode cluster, or
+`NewMemoryDBClient` with the cluster endpoint, together with `ElastiCacheOptions` or
+`MemoryDBOptions`. Acquisitions are retried during failovers, see `IsFailoverError`.
+With `MinReplicas`, ElastiCache locks are only reported as obtained once replicas
+acknowledged them (`WAIT`), so they survive a failover. MemoryDB persists acknowledged
+writes in its transaction log and needs no replicas to be awaited.
+
+## Packages
+
+The core package `github.com/bsm/redis-lock` depends on the standard library and
+[go-redis](https://github.com/go-redis/redis) only. Integrations and tooling live in
+separate packages, so they are never compiled into binaries which don't import them:
+
+* `github.com/bsm/redis-lock/locktest` - test helpers and mocks
+* `github.com/bsm/redis-lock/leaderelection` - Kubernetes leader election backend (`resourcelock.Interface`)
+* `github.com/bsm/redis-lock/lockadmin` - JSON admin endpoint listing current locks
+* `github.com/bsm/redis-lock/registry/yaml` - YAML configs for `Registry`
+* `github.com/bsm/redis-lock/cmd/lockbench` - contention simulator
+
 ## Testing
 
 Simply run:
@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrCommandsUnsupported is returned by VerifyPermissions if the client
+// cannot issue arbitrary commands
+var ErrCommandsUnsupported = errors.New("client does not support arbitrary commands")
+
+// PermissionError is returned by VerifyPermissions when the current user
+// is not allowed to run some of the required commands
+type PermissionError struct {
+	// User is the name of the Redis ACL user
+	User string
+
+	// Missing lists the denied commands
+	Missing []string
+}
+
+// Error implements error
+func (e *PermissionError) Error() string {
+	return "redis user " + e.User + " is missing ACL permissions for: " + strings.Join(e.Missing, ", ")
+}
+
+type doer interface {
+	Do(args ...interface{}) *redis.Cmd
+}
+
+// RequiredCommands returns the Redis commands used by this package,
+// including the ones invoked from within Lua scripts
+func RequiredCommands() []string {
+	names := make([]string, 0, len(probes))
+	for _, p := range probes {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+type probe struct {
+	name string
+	args func(key string) []interface{}
+}
+
+var probes = []probe{
+	{"set", func(key string) []interface{} { return []interface{}{"set", key, "token", "nx", "px", "1000"} }},
+	{"get", func(key string) []interface{} { return []interface{}{"get", key} }},
+	{"pttl", func(key string) []interface{} { return []interface{}{"pttl", key} }},
+	{"pexpire", func(key string) []interface{} { return []interface{}{"pexpire", key, "1000"} }},
+	{"del", func(key string) []interface{} { return []interface{}{"del", key} }},
+	{"eval", func(key string) []interface{} { return []interface{}{"eval", "return 0", "1", key} }},
+	{"evalsha", func(key string) []interface{} {
+		return []interface{}{"evalsha", "0000000000000000000000000000000000000000", "1", key}
+	}},
+	{"script|load", func(key string) []interface{} { return []interface{}{"script", "load", "return 0"} }},
+	{"zadd", func(key string) []interface{} { return []interface{}{"zadd", queueKey(key), "nx", "0", "token"} }},
+	{"zrank", func(key string) []interface{} { return []interface{}{"zrank", queueKey(key), "token"} }},
+	{"zrem", func(key string) []interface{} { return []interface{}{"zrem", queueKey(key), "token"} }},
+	{"zcard", func(key string) []interface{} { return []interface{}{"zcard", queueKey(key)} }},
+	{"zrange", func(key string) []interface{} { return []interface{}{"zrange", scheduleKey(key), "0", "-1"} }},
+	{"zrangebyscore", func(key string) []interface{} {
+		return []interface{}{"zrangebyscore", queueKey(key), "0", "+inf"}
+	}},
+	{"zremrangebyscore", func(key string) []interface{} {
+		return []interface{}{"zremrangebyscore", queueKey(key), "-inf", "0"}
+	}},
+	{"zincrby", func(key string) []interface{} { return []interface{}{"zincrby", intentsKey(key), "1", "token"} }},
+	{"zrevrank", func(key string) []interface{} { return []interface{}{"zrevrank", intentsKey(key), "token"} }},
+	{"exists", func(key string) []interface{} { return []interface{}{"exists", key} }},
+	{"hset", func(key string) []interface{} { return []interface{}{"hset", successorsKey(key), "id", "token"} }},
+	{"hget", func(key string) []interface{} { return []interface{}{"hget", successorsKey(key), "id"} }},
+	{"hdel", func(key string) []interface{} { return []interface{}{"hdel", successorsKey(key), "id"} }},
+	{"lpop", func(key string) []interface{} { return []interface{}{"lpop", key} }},
+	{"xadd", func(key string) []interface{} { return []interface{}{"xadd", auditKey(key), "*", "event", "probe"} }},
+	{"xrange", func(key string) []interface{} { return []interface{}{"xrange", auditKey(key), "-", "+"} }},
+	{"publish", func(key string) []interface{} { return []interface{}{"publish", eventsChannel(key), "probe"} }},
+	{"time", func(key string) []interface{} { return []interface{}{"time"} }},
+	{"wait", func(key string) []interface{} { return []interface{}{"wait", "0", "0"} }},
+	{"fcall", func(key string) []interface{} { return []interface{}{"fcall", functionName(luaGet), "1", key} }},
+	{"function|load", func(key string) []interface{} {
+		return []interface{}{"function", "load", "replace", "#!lua name=" + FunctionLibrary}
+	}},
+}
+
+// VerifyPermissions checks that the current Redis user may run all
+// RequiredCommands() on key. It returns a *PermissionError listing the
+// denied commands. Requires Redis 7+ (ACL DRYRUN).
+func VerifyPermissions(ctx context.Context, client RedisClient, key string) error {
+	c, ok := client.(doer)
+	if !ok {
+		return ErrCommandsUnsupported
+	}
+
+	user, err := c.Do("acl", "whoami").String()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, p := range probes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		args := append([]interface{}{"acl", "dryrun", user}, p.args(key)...)
+		res, err := c.Do(args...).String()
+		if err != nil {
+			return err
+		} else if res != "OK" {
+			missing = append(missing, p.name)
+		}
+	}
+
+	if len(missing) != 0 {
+		return &PermissionError{User: user, Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package lock
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Adopt returns a locker for a lock which is currently held with token,
+// e.g. handed over by another process or restored from persistence, see
+// Holder. The token is validated against the current holder and the TTL
+// reset to LockTimeout in one step. It returns ErrLockLost if the lock is
+// not held with token, and ErrInvalidToken if Options.TokenSecret is set
+// and token is not signed with it.
+func Adopt(client RedisClient, key, token string, opts *Options) (*Locker, error) {
+	locker := New(client, key, opts)
+	if len(locker.opts.TokenSecret) != 0 && !VerifyToken(key, token, locker.opts.TokenSecret) {
+		return nil, ErrInvalidToken
+	}
+
+	locker.mutex.Lock()
+	defer locker.mutex.Unlock()
+
+	raw, err := eval(client, luaGet, []string{key}).String()
+	if err == redis.Nil {
+		return nil, ErrLockLost
+	} else if err != nil {
+		return nil, err
+	}
+
+	value := raw
+	v, err := locker.opts.Codec.Decode(raw)
+	if locker.opts.AcceptLegacyValues && raw == token {
+		// Held with the plain token, see Options.AcceptLegacyValues
+		v = Value{Token: token}
+		if value, err = locker.opts.Codec.Encode(v); err != nil {
+			return nil, err
+		}
+	} else if err != nil || v.Token != token {
+		return nil, ErrLockLost
+	}
+
+	if ok, err := locker.adopt(value, v); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrLockLost
+	}
+	return locker, nil
+}
+
+// adopt takes over the lock if it is still held with value, which decodes
+// to v, and resets its TTL
+func (l *Locker) adopt(value string, v Value) (bool, error) {
+	start := monotime()
+	ttl := strconv.FormatInt(int64(l.opts.LockTimeout/time.Millisecond), 10)
+	status, err := eval(l.client, luaRefresh, []string{l.key}, append([]interface{}{value, ttl, ResetTTL.String()}, l.legacyArgs(value, v.Token)...)...).Result()
+	if err != nil || status != int64(1) {
+		return false, err
+	}
+
+	atomic.AddInt64(&stats.held, 1)
+	l.token = v.Token
+	l.value = value
+	l.meta = v.Metadata
+	l.setExpiry(start, l.opts.LockTimeout)
+	l.setState(Held)
+	l.audit(AuditAcquired)
+	l.heartbeat()
+	return true, l.track()
+}
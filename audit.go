@@ -0,0 +1,157 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const luaAudit = `return redis.call("xadd", KEYS[1], "maxlen", "~", ARGV[1], "*", "event", ARGV[2], "token", ARGV[3], "ttl", ARGV[4], "cid", ARGV[5])`
+const luaAuditRange = `local t = redis.call("time")
+local start = t[1] * 1000 + math.floor(t[2] / 1000) - tonumber(ARGV[1])
+return {t[1], t[2], redis.call("xrange", KEYS[1], string.format("%d", start), "+")}`
+
+const auditMaxLen = "1000"
+
+// Audit event names
+const (
+	AuditAcquired  = "acquired"
+	AuditRefreshed = "refreshed"
+	AuditReleased  = "released"
+)
+
+// HoldInterval is a period during which a token held a lock,
+// according to the audit stream
+type HoldInterval struct {
+	Token         string
+	CorrelationID string
+	Start         time.Time
+	End           time.Time
+}
+
+// Overlap is a pair of intersecting hold intervals
+type Overlap struct {
+	First, Second HoldInterval
+}
+
+// ExclusivityReport is returned by AuditExclusivity
+type ExclusivityReport struct {
+	// Holds lists all hold intervals, ordered by start time
+	Holds []HoldInterval
+
+	// Overlaps lists all pairs of intersecting hold intervals.
+	// A non-empty list indicates a violation of mutual exclusion.
+	Overlaps []Overlap
+}
+
+// AuditExclusivity inspects the audit stream of key (see Options.Audit)
+// for the given time window and reports overlapping hold intervals.
+// Times are based on the Redis server clock.
+func AuditExclusivity(ctx context.Context, client RedisClient, key string, window time.Duration) (*ExclusivityReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err := eval(client, luaAuditRange, []string{auditKey(key)}, strconv.FormatInt(int64(window/time.Millisecond), 10)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now     time.Time
+		entries []interface{}
+	)
+	if vals, _ := res.([]interface{}); len(vals) == 3 {
+		sec, _ := strconv.ParseInt(fmt.Sprint(vals[0]), 10, 64)
+		usec, _ := strconv.ParseInt(fmt.Sprint(vals[1]), 10, 64)
+		now = time.Unix(sec, usec*int64(time.Microsecond))
+		entries, _ = vals[2].([]interface{})
+	}
+
+	// Keep holds in stream order, so holds starting within the same
+	// millisecond are reported in the order they were acquired
+	var order []*HoldInterval
+	holds := make(map[string]*HoldInterval)
+	for _, entry := range entries {
+		id, fields := parseStreamEntry(entry)
+		at := streamIDTime(id)
+
+		token, event := fields["token"], fields["event"]
+		ttl, _ := strconv.ParseInt(fields["ttl"], 10, 64)
+		expires := at.Add(time.Duration(ttl) * time.Millisecond)
+
+		hold, ok := holds[token]
+		if !ok {
+			hold = &HoldInterval{Token: token, CorrelationID: fields["cid"], Start: at}
+			holds[token] = hold
+			order = append(order, hold)
+		}
+
+		switch event {
+		case AuditAcquired, AuditRefreshed:
+			hold.End = expires
+		case AuditReleased:
+			hold.End = at
+		}
+	}
+
+	report := new(ExclusivityReport)
+	for _, hold := range order {
+		if hold.End.After(now) {
+			hold.End = now
+		}
+		report.Holds = append(report.Holds, *hold)
+	}
+	sort.SliceStable(report.Holds, func(i, j int) bool { return report.Holds[i].Start.Before(report.Holds[j].Start) })
+
+	for i, a := range report.Holds {
+		for _, b := range report.Holds[i+1:] {
+			if b.Start.Before(a.End) && a.Start.Before(b.End) {
+				report.Overlaps = append(report.Overlaps, Overlap{First: a, Second: b})
+			}
+		}
+	}
+	return report, nil
+}
+
+// audit appends an event to the audit stream, errors are ignored
+func (l *Locker) audit(event string) {
+	if !l.opts.Audit {
+		return
+	}
+
+	ttl := strconv.FormatInt(int64(l.opts.LockTimeout/time.Millisecond), 10)
+	_ = eval(l.client, luaAudit, []string{auditKey(l.key)}, auditMaxLen, event, l.token, ttl, l.meta[MetaCorrelationID]).Err()
+}
+
+func auditKey(key string) string {
+	return key + ":audit"
+}
+
+func parseStreamEntry(entry interface{}) (string, map[string]string) {
+	pair, _ := entry.([]interface{})
+	if len(pair) != 2 {
+		return "", nil
+	}
+
+	id, _ := pair[0].(string)
+	kvs, _ := pair[1].([]interface{})
+	fields := make(map[string]string, len(kvs)/2)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		k, _ := kvs[i].(string)
+		v, _ := kvs[i+1].(string)
+		fields[k] = v
+	}
+	return id, fields
+}
+
+func streamIDTime(id string) time.Time {
+	if pos := strings.IndexByte(id, '-'); pos > -1 {
+		id = id[:pos]
+	}
+	ms, _ := strconv.ParseInt(id, 10, 64)
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
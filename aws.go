@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrNotReplicated is returned by Lock() if fewer than Options.MinReplicas
+// replicas acknowledged the lock within Options.ReplicaTimeout. The lock
+// is released again, as it could be lost on failover.
+var ErrNotReplicated = errors.New("lock not acknowledged by replicas")
+
+// NewElastiCacheClient creates a client for the configuration endpoint of
+// an ElastiCache cluster in cluster mode, e.g.
+// "clustercfg.my-cluster.abc123.use1.cache.amazonaws.com:6379". Set useTLS
+// if in-transit encryption is enabled, authToken if AUTH is enabled.
+// Commands are always routed to primaries, replicas may lag behind.
+func NewElastiCacheClient(configEndpoint, authToken string, useTLS bool) *redis.ClusterClient {
+	opts := &redis.ClusterOptions{
+		Addrs:    []string{configEndpoint},
+		Password: authToken,
+		// Follow redirects while slots move during failovers
+		MaxRedirects: 16,
+	}
+	if useTLS {
+		opts.TLSConfig = endpointTLS(configEndpoint)
+	}
+	return redis.NewClusterClient(opts)
+}
+
+// NewMemoryDBClient creates a client for the cluster endpoint of a MemoryDB
+// cluster, which always requires TLS. Password authenticates the default user.
+func NewMemoryDBClient(clusterEndpoint, password string) *redis.ClusterClient {
+	return redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:        []string{clusterEndpoint},
+		Password:     password,
+		MaxRedirects: 16,
+		TLSConfig:    endpointTLS(clusterEndpoint),
+	})
+}
+
+// ElastiCacheOptions returns options suited for ElastiCache. Acquisitions
+// are retried during failovers (see IsFailoverError) and, if replicas > 0,
+// must be acknowledged by that many replicas per shard.
+func ElastiCacheOptions(replicas int) *Options {
+	return &Options{
+		RetryOnError:   true,
+		IsRetryable:    IsFailoverError,
+		MinReplicas:    replicas,
+		ReplicaTimeout: DefaultReplicaTimeout,
+	}
+}
+
+// MemoryDBOptions returns options suited for MemoryDB. Acquisitions are
+// retried during failovers (see IsFailoverError). Acknowledged writes are
+// durable in the multi-AZ transaction log, so no replicas are awaited.
+func MemoryDBOptions() *Options {
+	return &Options{
+		RetryOnError: true,
+		IsRetryable:  IsFailoverError,
+	}
+}
+
+// IsFailoverError is like IsTransientError, but also accepts errors
+// returned to blocked clients during (forced) failovers
+func IsFailoverError(err error) bool {
+	return IsTransientError(err) || strings.HasPrefix(err.Error(), "UNBLOCKED ")
+}
+
+func endpointTLS(endpoint string) *tls.Config {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		host = endpoint
+	}
+	return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+}
+
+type watcher interface {
+	Watch(fn func(*redis.Tx) error, keys ...string) error
+}
+
+// obtainReplicated obtains the lock and waits for Options.MinReplicas
+// replicas to acknowledge it. WAIT only covers writes issued on the same
+// connection, so both run within a dedicated connection. Servers which
+// don't support WAIT (e.g. MemoryDB) are trusted to be durable.
+func (l *Locker) obtainReplicated(value string) (bool, error) {
+	w, ok := l.client.(watcher)
+	if !ok {
+		return false, ErrCommandsUnsupported
+	}
+
+	var obtained bool
+	err := w.Watch(func(tx *redis.Tx) (err error) {
+		if obtained, err = l.acquire(tx, value); err != nil || !obtained {
+			return err
+		}
+
+		l.cost.command()
+		cmd := redis.NewIntCmd("wait", l.opts.MinReplicas, int64(l.opts.ReplicaTimeout/time.Millisecond))
+		_ = tx.Process(cmd)
+		n, err := cmd.Result()
+		if err != nil && strings.HasPrefix(err.Error(), "ERR unknown command") {
+			return nil
+		} else if err == nil && n < int64(l.opts.MinReplicas) {
+			err = ErrNotReplicated
+		}
+		return err
+	}, l.key)
+	if err != nil && obtained {
+		_ = eval(l.client, luaRelease, []string{l.key}, value).Err()
+		if l.opts.HolderID != "" {
+			_ = eval(l.client, luaUntrack, l.trackingKeys()).Err()
+		}
+		return false, err
+	}
+	return obtained, err
+}
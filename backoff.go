@@ -0,0 +1,40 @@
+package lock
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes the delay before the next acquisition attempt from
+// the base delay (Options.WaitRetry) and the previous delay (zero before
+// the first retry)
+type Backoff func(base, prev time.Duration) time.Duration
+
+// DefaultBackoff is used when Options.Backoff is not set. Assign it
+// once at startup to change the strategy for all lockers.
+var DefaultBackoff Backoff = ConstantBackoff
+
+// ConstantBackoff always waits for the base delay
+func ConstantBackoff(base, _ time.Duration) time.Duration {
+	return base
+}
+
+// DecorrelatedJitter returns an AWS-style "decorrelated jitter" backoff,
+// which picks a random delay between base and three times the previous
+// delay, capped at max. It spreads retries of competing processes.
+func DecorrelatedJitter(max time.Duration) Backoff {
+	return func(base, prev time.Duration) time.Duration {
+		if prev < base {
+			prev = base
+		}
+
+		delay := base
+		if upper := prev * 3; upper > base {
+			delay += time.Duration(rand.Int63n(int64(upper - base)))
+		}
+		if max > 0 && delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
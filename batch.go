@@ -0,0 +1,108 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BatchError is returned by RunEachWithLock if any key failed
+type BatchError struct {
+	// Errors maps each failed key to its error, which is a *LockError if
+	// the lock could not be obtained
+	Errors map[string]error
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	keys := e.keys()
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, key+": "+e.Errors[key].Error())
+	}
+	return "lock: " + strconv.Itoa(len(keys)) + " keys failed: " + strings.Join(msgs, "; ")
+}
+
+// Is allows errors.Is on the errors of all keys
+func (e *BatchError) Is(target error) bool {
+	for _, key := range e.keys() {
+		if errors.Is(e.Errors[key], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As allows errors.As on the errors of all keys, in key order
+func (e *BatchError) As(target interface{}) bool {
+	for _, key := range e.keys() {
+		if errors.As(e.Errors[key], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the failed keys in order
+func (e *BatchError) keys() []string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RunEachWithLock runs fn for every key under its own lock, see
+// RunWithLockContext, with at most limit keys in parallel. Keys which are
+// not started before ctx is done fail with the context error. All keys are
+// processed; failures are returned together as a *BatchError. Keys must be
+// unique.
+func RunEachWithLock(ctx context.Context, client RedisClient, keys []string, opts *Options, limit int, fn func(ctx context.Context, key string) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errs  = make(map[string]error)
+		slots = make(chan struct{}, limit)
+	)
+	record := func(key string, err error) {
+		if err != nil {
+			mu.Lock()
+			errs[key] = err
+			mu.Unlock()
+		}
+	}
+
+	for _, key := range keys {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			record(key, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(key string) {
+			defer func() { <-slots; wg.Done() }()
+
+			if err := ctx.Err(); err != nil {
+				record(key, err)
+				return
+			}
+			record(key, RunWithLockContext(ctx, client, key, opts, func(ctx context.Context) error { return fn(ctx, key) }))
+		}(key)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
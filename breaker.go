@@ -0,0 +1,75 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBackendUnhealthy is returned while a Breaker is open
+var ErrBackendUnhealthy = errors.New("redis backend unhealthy")
+
+// Breaker is a circuit breaker for lock acquisitions. After Threshold
+// consecutive failed or slow attempts, all acquisitions sharing the
+// breaker fail fast with ErrBackendUnhealthy for Cooldown. A Breaker
+// must be shared by pointer, e.g. across all lockers of a process.
+type Breaker struct {
+	// MaxLatency marks attempts slower than this as failed.
+	// Default: 0 = latency is not considered
+	MaxLatency time.Duration
+
+	// Threshold is the number of consecutive failures which opens the breaker.
+	// Default: 5
+	Threshold int
+
+	// Cooldown is the time the breaker stays open.
+	// Default: 1s
+	Cooldown time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Duration
+}
+
+// allow returns ErrBackendUnhealthy if the breaker is open
+func (b *Breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if monotime() < b.openUntil {
+		return ErrBackendUnhealthy
+	}
+	return nil
+}
+
+// record records the outcome of an attempt
+func (b *Breaker) record(latency time.Duration, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil && (b.MaxLatency <= 0 || latency <= b.MaxLatency) {
+		b.failures = 0
+		return
+	}
+
+	threshold, cooldown := b.Threshold, b.Cooldown
+	if threshold < 1 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = time.Second
+	}
+
+	if b.failures++; b.failures >= threshold {
+		b.failures = 0
+		b.openUntil = monotime() + cooldown
+	}
+}
@@ -0,0 +1,60 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Budget limits the total time spent waiting for locks across multiple
+// acquisitions, e.g. within one request. It is safe for concurrent use.
+type Budget struct {
+	remaining time.Duration
+	mu        sync.Mutex
+}
+
+// NewBudget returns a budget of total wait time
+func NewBudget(total time.Duration) *Budget {
+	return &Budget{remaining: total}
+}
+
+// Remaining returns the remaining wait time
+func (b *Budget) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.remaining
+}
+
+// limit caps wait at the remaining budget
+func (b *Budget) limit(wait time.Duration) time.Duration {
+	if remaining := b.Remaining(); wait > remaining {
+		return remaining
+	}
+	return wait
+}
+
+// consume draws d from the budget
+func (b *Budget) consume(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.remaining -= d; b.remaining < 0 {
+		b.remaining = 0
+	}
+}
+
+type budgetKey struct{}
+
+// ContextWithBudget returns a context carrying budget. LockContext waits at
+// most for the remaining budget (and Options.WaitTimeout) and draws the
+// time spent from it. Once exhausted, locks are attempted once only.
+func ContextWithBudget(ctx context.Context, budget *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, budget)
+}
+
+// BudgetFromContext returns the budget carried by ctx, if any
+func BudgetFromContext(ctx context.Context) *Budget {
+	budget, _ := ctx.Value(budgetKey{}).(*Budget)
+	return budget
+}
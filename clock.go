@@ -0,0 +1,57 @@
+package lock
+
+import "time"
+
+// luaServerTime defines servertime(), which returns the Redis server time
+// in milliseconds. Timestamps shared between clients (queue and holder set
+// scores) are taken from the server, so they are not affected by clock skew
+// between clients. Local deadlines rely on the monotonic clock only.
+const luaServerTime = `if redis.replicate_commands then redis.replicate_commands() end
+local function servertime() local t = redis.call("time") return t[1] * 1000 + math.floor(t[2] / 1000) end
+`
+
+// clockStepThreshold is the minimum wall clock step reported to
+// Options.OnClockStep
+const clockStepThreshold = time.Second
+
+// monoBase anchors local timestamps to the monotonic clock
+var monoBase = time.Now()
+
+// monotime returns the time elapsed since monoBase. It is not affected by
+// steps of the wall clock, e.g. by NTP.
+func monotime() time.Duration {
+	return time.Since(monoBase)
+}
+
+// wallNow returns the wall clock time, without monotonic reading
+var wallNow = func() time.Time { return time.Now().Round(0) }
+
+// clockReading is a pair of wall and monotonic clock readings
+type clockReading struct {
+	wall time.Time
+	mono time.Duration
+}
+
+func readClock() clockReading {
+	return clockReading{wall: wallNow(), mono: monotime()}
+}
+
+// checkClock reports steps of the wall clock since the last check to
+// Options.OnClockStep
+func (l *Locker) checkClock() {
+	if l.opts.OnClockStep == nil {
+		return
+	}
+
+	now := readClock()
+	prev := l.clock
+	l.clock = now
+	if prev.wall.IsZero() {
+		return
+	}
+
+	step := now.wall.Sub(prev.wall) - (now.mono - prev.mono)
+	if step >= clockStepThreshold || step <= -clockStepThreshold {
+		l.opts.OnClockStep(step)
+	}
+}
@@ -0,0 +1,199 @@
+// Command lockbench simulates lock contention against a Redis server and
+// reports acquisition latencies, fairness and failure rates for a given
+// set of lock options.
+//
+// Usage:
+//
+//	lockbench -addr 127.0.0.1:6379 -procs 4 -workers 16 -duration 30s -wait-timeout 1s
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+)
+
+var flags struct {
+	addr     string
+	db       int
+	procs    int
+	workers  int
+	keys     int
+	prefix   string
+	duration time.Duration
+	hold     time.Duration
+	jitter   bool
+
+	opts lock.Options
+}
+
+func init() {
+	flag.StringVar(&flags.addr, "addr", "127.0.0.1:6379", "Redis address")
+	flag.IntVar(&flags.db, "db", 0, "Redis database")
+	flag.IntVar(&flags.procs, "procs", 4, "Number of simulated processes, each with its own connection pool")
+	flag.IntVar(&flags.workers, "workers", 8, "Number of goroutines per process")
+	flag.IntVar(&flags.keys, "keys", 1, "Number of distinct lock keys to contend on")
+	flag.StringVar(&flags.prefix, "prefix", "lockbench:", "Key prefix")
+	flag.DurationVar(&flags.duration, "duration", 10*time.Second, "Benchmark duration")
+	flag.DurationVar(&flags.hold, "hold", 10*time.Millisecond, "Time to hold each acquired lock")
+
+	flag.DurationVar(&flags.opts.LockTimeout, "lock-timeout", lock.DefaultLockTimeout, "Options.LockTimeout")
+	flag.DurationVar(&flags.opts.WaitTimeout, "wait-timeout", 0, "Options.WaitTimeout")
+	flag.DurationVar(&flags.opts.WaitRetry, "wait-retry", 100*time.Millisecond, "Options.WaitRetry")
+	flag.IntVar(&flags.opts.RetriesCount, "retries", 0, "Options.RetriesCount")
+	flag.BoolVar(&flags.jitter, "jitter", false, "Use decorrelated jitter backoff, capped at -wait-timeout")
+	flag.IntVar(&flags.opts.MaxQueueDepth, "max-queue-depth", 0, "Options.MaxQueueDepth")
+}
+
+func main() {
+	flag.Parse()
+	if flags.procs < 1 || flags.workers < 1 || flags.keys < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.jitter {
+		flags.opts.Backoff = lock.DecorrelatedJitter(flags.opts.WaitTimeout)
+	}
+
+	stats := make([]*procStats, flags.procs)
+	stop := time.Now().Add(flags.duration)
+
+	var wg sync.WaitGroup
+	for p := 0; p < flags.procs; p++ {
+		client := redis.NewClient(&redis.Options{
+			Addr:     flags.addr,
+			DB:       flags.db,
+			PoolSize: flags.workers,
+		})
+		defer client.Close()
+
+		if err := client.Ping().Err(); err != nil {
+			log.Fatalf("lockbench: %v", err)
+		}
+
+		stats[p] = new(procStats)
+		for w := 0; w < flags.workers; w++ {
+			wg.Add(1)
+			go func(client *redis.Client, st *procStats) {
+				defer wg.Done()
+				work(client, st, stop)
+			}(client, stats[p])
+		}
+	}
+	wg.Wait()
+
+	report(stats)
+}
+
+func work(client *redis.Client, st *procStats, stop time.Time) {
+	for time.Now().Before(stop) {
+		key := fmt.Sprintf("%s%d", flags.prefix, rand.Intn(flags.keys))
+		opts := flags.opts
+		locker := lock.New(client, key, &opts)
+
+		start := time.Now()
+		ok, err := locker.Lock()
+		st.record(time.Since(start), ok, err)
+		if !ok || err != nil {
+			continue
+		}
+
+		time.Sleep(flags.hold)
+		if err := locker.Unlock(); err != nil {
+			st.recordUnlockError()
+		}
+	}
+}
+
+type procStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	acquired  int
+	failed    int
+	errors    int
+	unlockErr int
+}
+
+func (s *procStats) record(latency time.Duration, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil:
+		s.errors++
+	case ok:
+		s.acquired++
+		s.latencies = append(s.latencies, latency)
+	default:
+		s.failed++
+	}
+}
+
+func (s *procStats) recordUnlockError() {
+	s.mu.Lock()
+	s.unlockErr++
+	s.mu.Unlock()
+}
+
+func report(stats []*procStats) {
+	var (
+		latencies                           []time.Duration
+		acquired, failed, errors, unlockErr int
+		shares                              []float64
+	)
+	for _, st := range stats {
+		latencies = append(latencies, st.latencies...)
+		acquired += st.acquired
+		failed += st.failed
+		errors += st.errors
+		unlockErr += st.unlockErr
+		shares = append(shares, float64(st.acquired))
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	attempts := acquired + failed + errors
+	fmt.Printf("attempts:  %d\n", attempts)
+	if attempts == 0 {
+		return
+	}
+	fmt.Printf("acquired:  %d (%.1f%%)\n", acquired, 100*float64(acquired)/float64(attempts))
+	fmt.Printf("failed:    %d (%.1f%%)\n", failed, 100*float64(failed)/float64(attempts))
+	fmt.Printf("errors:    %d (%.1f%%)\n", errors, 100*float64(errors)/float64(attempts))
+	fmt.Printf("unlock errors: %d\n", unlockErr)
+	fmt.Println()
+	fmt.Printf("latency:   p50=%s p90=%s p99=%s max=%s\n",
+		percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99), percentile(latencies, 1))
+	fmt.Printf("fairness:  %.3f (Jain's index across processes, 1 = perfectly fair)\n", jain(shares))
+	for i, st := range stats {
+		fmt.Printf("  proc %-3d acquired=%d failed=%d errors=%d unlock_errors=%d\n", i, st.acquired, st.failed, st.errors, st.unlockErr)
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+func jain(xs []float64) float64 {
+	var sum, sumSq float64
+	for _, x := range xs {
+		sum += x
+		sumSq += x * x
+	}
+	if sumSq == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(xs)) * sumSq)
+}
@@ -0,0 +1,132 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrNotLocked is returned by Holder if the key is not locked
+var ErrNotLocked = errors.New("not locked")
+
+// ErrUnsupportedVersion is returned when decoding values written
+// in a newer format than supported
+var ErrUnsupportedVersion = errors.New("unsupported value version")
+
+// Value is the content of a lock key
+type Value struct {
+	// Token is the unique token of the holder
+	Token string `json:"token"`
+
+	// Metadata contains optional holder information
+	Metadata map[string]string `json:"meta,omitempty"`
+
+	// Version is the schema version of the decoded value, see VersionedCodec
+	Version int `json:"-"`
+}
+
+// ValueCodec controls how values are stored in Redis. Encode must be
+// deterministic, values are compared byte-by-byte on refresh and release.
+type ValueCodec interface {
+	Encode(Value) (string, error)
+	Decode(string) (Value, error)
+}
+
+// PlainCodec stores the plain token, metadata is discarded.
+// This is the default codec.
+var PlainCodec ValueCodec = plainCodec{}
+
+// JSONCodec stores tokens and metadata as JSON objects,
+// e.g. {"token":"...","meta":{"host":"..."}}
+var JSONCodec ValueCodec = jsonCodec{}
+
+// VersionedCodec stores values in a versioned format, e.g.
+// "v2|token|host=a&pod=b". It decodes all versions, values without
+// a version prefix are parsed as plain tokens (version 1).
+var VersionedCodec ValueCodec = versionedCodec{}
+
+type plainCodec struct{}
+
+func (plainCodec) Encode(v Value) (string, error) { return v.Token, nil }
+func (plainCodec) Decode(s string) (Value, error) { return Value{Token: s}, nil }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v Value) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (jsonCodec) Decode(s string) (Value, error) {
+	var v Value
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+const valueVersion = 2
+
+type versionedCodec struct{}
+
+func (versionedCodec) Encode(v Value) (string, error) {
+	meta := make(url.Values, len(v.Metadata))
+	for k, val := range v.Metadata {
+		meta.Set(k, val)
+	}
+	return "v" + strconv.Itoa(valueVersion) + "|" + v.Token + "|" + meta.Encode(), nil
+}
+
+func (versionedCodec) Decode(s string) (Value, error) {
+	parts := strings.SplitN(s, "|", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "v") {
+		return Value{Token: s, Version: 1}, nil
+	}
+
+	version, err := strconv.Atoi(parts[0][1:])
+	if err != nil {
+		return Value{Token: s, Version: 1}, nil
+	} else if version > valueVersion {
+		return Value{}, ErrUnsupportedVersion
+	}
+
+	v := Value{Token: parts[1], Version: version}
+	if len(parts) == 3 && parts[2] != "" {
+		meta, err := url.ParseQuery(parts[2])
+		if err != nil {
+			return Value{}, err
+		}
+		v.Metadata = make(map[string]string, len(meta))
+		for k := range meta {
+			v.Metadata[k] = meta.Get(k)
+		}
+	}
+	return v, nil
+}
+
+// Holder returns the decoded value of the current holder of key, using
+// the codec configured in opts. It returns ErrNotLocked if the key is not locked.
+func Holder(client RedisClient, key string, opts *Options) (*Value, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	opts = opts.normalize()
+
+	raw, err := eval(client, luaGet, []string{key}).String()
+	if err == redis.Nil {
+		return nil, ErrNotLocked
+	} else if err != nil {
+		return nil, err
+	}
+
+	v, err := opts.Codec.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.TokenSecret) != 0 && !VerifyToken(key, v.Token, opts.TokenSecret) {
+		return nil, ErrInvalidToken
+	}
+	return &v, nil
+}
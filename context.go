@@ -0,0 +1,110 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrExecutionTimeout is returned by RunWithLock and RunWithLockContext if
+// the handler exceeded Options.ExecutionTimeout
+var ErrExecutionTimeout = errors.New("lock handler exceeded execution timeout")
+
+// LockUntilDone obtains a lock which is refreshed in the background and
+// released automatically as soon as ctx is done. If we can't get a lock,
+// it returns a `*LockError`.
+func LockUntilDone(ctx context.Context, client RedisClient, key string, opts *Options) (*Locker, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	locker, err := obtainLock(client, key, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	go locker.keepAlive(ctx)
+	return locker, nil
+}
+
+// RunWithLockContext runs handler while holding the lock, which is refreshed
+// in the background. The context passed to handler is cancelled and the
+// lock released once ctx is done or Options.ExecutionTimeout is exceeded,
+// in which case ErrExecutionTimeout is returned. If we can't get a lock,
+// it returns a `*LockError`.
+func RunWithLockContext(ctx context.Context, client RedisClient, key string, opts *Options, handler func(ctx context.Context) error) error {
+	var (
+		locker *Locker
+		err    error
+	)
+	profile(ctx, opts, key, "waiting", func(context.Context) { locker, err = obtainLock(client, key, opts) })
+	if err != nil {
+		return err
+	}
+
+	execCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout := locker.opts.ExecutionTimeout; timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	stop := locker.keepAliveBackground(execCtx)
+	profile(execCtx, opts, key, "held", func(ctx context.Context) { err = handler(ctx) })
+	stop()
+
+	if execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return ErrExecutionTimeout
+	}
+	return err
+}
+
+// keepAliveBackground runs keepAlive in the background. The returned
+// function releases the lock and waits for keepAlive to return.
+func (l *Locker) keepAliveBackground(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.keepAlive(ctx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// keepAlive refreshes the lock until ctx is done, then releases it.
+// It stops early if the lock was released or lost.
+func (l *Locker) keepAlive(ctx context.Context) {
+	atomic.AddInt64(&stats.refreshLoops, 1)
+	defer atomic.AddInt64(&stats.refreshLoops, -1)
+
+	ticker := time.NewTicker(l.opts.LockTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = l.Unlock()
+			return
+		case <-ticker.C:
+			if ok, err := l.extend(); err == nil && !ok {
+				return
+			}
+		}
+	}
+}
+
+// extend refreshes a held lock, it never creates a new one. A lost lock
+// is left in the Lost state.
+func (l *Locker) extend() (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" || l.draining {
+		return false, nil
+	}
+	return l.renew()
+}
@@ -0,0 +1,58 @@
+package lock
+
+import "context"
+
+// MetaCorrelationID is the metadata key of the correlation ID
+const MetaCorrelationID = "correlation_id"
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a context carrying a correlation ID,
+// which is used by LockContext to tie the lock lifecycle to a request
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by ctx, if any
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// CorrelationID returns the correlation ID of the current lock, either taken
+// from the context passed to LockContext or generated on acquisition.
+// It is stored in the metadata and included in all audit events.
+func (l *Locker) CorrelationID() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.meta[MetaCorrelationID]
+}
+
+// metadata returns Options.Metadata with the correlation ID of ctx,
+// a new correlation ID is generated unless present
+func (l *Locker) metadata(ctx context.Context) (map[string]string, error) {
+	id := CorrelationIDFromContext(ctx)
+	if id == "" {
+		var err error
+		if id, err = randomToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := make(map[string]string, len(l.opts.Metadata)+4)
+	for k, v := range l.opts.Metadata {
+		meta[k] = v
+	}
+	meta[MetaCorrelationID] = id
+	if l.storesOwner() {
+		meta[MetaOwnerID] = l.opts.OwnerID
+	}
+	if l.opts.Environment != "" {
+		meta[MetaEnvironment] = l.opts.Environment
+	}
+	if l.opts.Datacenter != "" {
+		meta[MetaDatacenter] = l.opts.Datacenter
+	}
+	return meta, nil
+}
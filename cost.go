@@ -0,0 +1,78 @@
+package lock
+
+import "sync/atomic"
+
+// AcquisitionCost describes the Redis load of an acquisition, for capacity
+// planning. It counts the wait loop, i.e. the attempts and the lookups
+// between them; bookkeeping after success, such as audit entries and
+// heartbeats, is not included.
+type AcquisitionCost struct {
+	// Attempts is the number of acquisition attempts
+	Attempts int
+
+	// Commands is the number of Redis round trips, including Scripts
+	Commands int
+
+	// Scripts is the number of script calls (EVAL, EVALSHA or FCALL)
+	Scripts int
+
+	// Messages is the number of pub/sub messages received while waiting,
+	// see Standby
+	Messages int
+}
+
+// costCounter counts the Redis load of acquisitions. Cumulative counters
+// are not reset by Lock(), so they span several calls, see Standby.
+type costCounter struct {
+	attempts, commands, scripts, messages int64
+	cumulative                            bool
+}
+
+func (c *costCounter) attempt() { atomic.AddInt64(&c.attempts, 1) }
+func (c *costCounter) command() { atomic.AddInt64(&c.commands, 1) }
+
+func (c *costCounter) script() {
+	atomic.AddInt64(&c.commands, 1)
+	atomic.AddInt64(&c.scripts, 1)
+}
+
+func (c *costCounter) message() {
+	atomic.AddInt64(&c.messages, 1)
+	atomic.AddInt64(&stats.acquisitionMessages, 1)
+}
+
+func (c *costCounter) snapshot() AcquisitionCost {
+	return AcquisitionCost{
+		Attempts: int(atomic.LoadInt64(&c.attempts)),
+		Commands: int(atomic.LoadInt64(&c.commands)),
+		Scripts:  int(atomic.LoadInt64(&c.scripts)),
+		Messages: int(atomic.LoadInt64(&c.messages)),
+	}
+}
+
+// begin starts counting an acquisition and returns a function which adds
+// its cost to the process-wide Stats
+func (c *costCounter) begin() (end func()) {
+	if !c.cumulative {
+		atomic.StoreInt64(&c.attempts, 0)
+		atomic.StoreInt64(&c.commands, 0)
+		atomic.StoreInt64(&c.scripts, 0)
+		atomic.StoreInt64(&c.messages, 0)
+	}
+
+	before := c.snapshot()
+	return func() {
+		after := c.snapshot()
+		atomic.AddInt64(&stats.acquisitions, 1)
+		atomic.AddInt64(&stats.acquisitionAttempts, int64(after.Attempts-before.Attempts))
+		atomic.AddInt64(&stats.acquisitionCommands, int64(after.Commands-before.Commands))
+		atomic.AddInt64(&stats.acquisitionScripts, int64(after.Scripts-before.Scripts))
+	}
+}
+
+// AcquisitionCost returns the Redis load of the last Lock() call, whether
+// it succeeded or not. For lockers returned by Standby, it covers all
+// attempts of the standby.
+func (l *Locker) AcquisitionCost() AcquisitionCost {
+	return l.cost.snapshot()
+}
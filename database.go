@@ -0,0 +1,69 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis"
+)
+
+// RequireDefaultDB is the Options.RequireDB value for logical DB 0
+const RequireDefaultDB = -1
+
+// ErrDBMismatch is returned by Lock() if the client does not use
+// the logical DB required by Options.RequireDB
+var ErrDBMismatch = errors.New("client uses a different logical DB")
+
+// clientDB returns the logical DB used by client
+func clientDB(client RedisClient) (int, error) {
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.Options().DB, nil
+	case *redis.Ring:
+		// Ring does not expose its options, shards are visited concurrently
+		var db int32 = -1
+		err := c.ForEachShard(func(shard *redis.Client) error {
+			atomic.StoreInt32(&db, int32(shard.Options().DB))
+			return nil
+		})
+		return int(atomic.LoadInt32(&db)), err
+	case *redis.ClusterClient:
+		// Redis Cluster only supports DB 0
+		return 0, nil
+	case interface {
+		Do(args ...interface{}) *redis.Cmd
+	}:
+		info, err := c.Do("CLIENT", "INFO").String()
+		if err != nil {
+			return -1, err
+		}
+		for _, field := range strings.Fields(info) {
+			if strings.HasPrefix(field, "db=") {
+				return strconv.Atoi(field[3:])
+			}
+		}
+	}
+	return -1, fmt.Errorf("%w: cannot determine DB of %T", ErrDBMismatch, client)
+}
+
+// checkDB fails fast if the client does not use the required logical DB
+func (l *Locker) checkDB() error {
+	want := l.opts.RequireDB
+	if want == 0 {
+		return nil
+	} else if want == RequireDefaultDB {
+		want = 0
+	}
+
+	db, err := clientDB(l.client)
+	if err != nil {
+		return err
+	}
+	if db != want {
+		return fmt.Errorf("%w: want DB %d, got %d", ErrDBMismatch, want, db)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package lock
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadman is returned when a held lock was released instead of
+// refreshed, because the holder made no progress, see Options.DeadmanInterval
+var ErrDeadman = errors.New("holder made no progress within deadman interval")
+
+// Progress signals that the holder is still making progress. With
+// Options.DeadmanInterval, locks are only refreshed while Progress is
+// called at least once per interval. It is safe for concurrent use.
+func (l *Locker) Progress() {
+	atomic.StoreInt64(&l.progressAt, int64(monotime()))
+}
+
+// deadmanExpired reports whether the holder missed the deadman interval
+func (l *Locker) deadmanExpired() bool {
+	if l.opts.DeadmanInterval <= 0 {
+		return false
+	}
+	return monotime()-time.Duration(atomic.LoadInt64(&l.progressAt)) > l.opts.DeadmanInterval
+}
@@ -0,0 +1,49 @@
+package lock
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoDefaultClient is returned by Obtain and RunDefault if no client was
+// registered with SetDefaultClient
+var ErrNoDefaultClient = errors.New("no default client registered")
+
+var defaultClient struct {
+	client RedisClient
+	mu     sync.RWMutex
+}
+
+// SetDefaultClient registers the client used by Obtain and RunDefault,
+// for applications with a single Redis. It is safe for concurrent use.
+func SetDefaultClient(client RedisClient) {
+	defaultClient.mu.Lock()
+	defaultClient.client = client
+	defaultClient.mu.Unlock()
+}
+
+// DefaultClient returns the client registered with SetDefaultClient
+func DefaultClient() RedisClient {
+	defaultClient.mu.RLock()
+	defer defaultClient.mu.RUnlock()
+
+	return defaultClient.client
+}
+
+// Obtain is like ObtainLock, but uses the default client
+func Obtain(key string, opts *Options) (*Locker, error) {
+	client := DefaultClient()
+	if client == nil {
+		return nil, ErrNoDefaultClient
+	}
+	return ObtainLock(client, key, opts)
+}
+
+// RunDefault is like RunWithLock, but uses the default client
+func RunDefault(key string, opts *Options, handler func() error) error {
+	client := DefaultClient()
+	if client == nil {
+		return ErrNoDefaultClient
+	}
+	return RunWithLock(client, key, opts, handler)
+}
@@ -0,0 +1,72 @@
+package lock
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+)
+
+const luaPublish = `return redis.call("publish", ARGV[1], ARGV[2])`
+
+// EventReleasing is published on key + ":events" when a holder
+// starts draining, see Drain
+const EventReleasing = "releasing"
+
+// Drain prepares a handover: it stops background refreshes (see
+// LockUntilDone), shortens the remaining TTL to drain (or releases
+// the lock immediately if drain is zero) and publishes EventReleasing
+// on key + ":events" so standbys can prepare to take over.
+func (l *Locker) Drain(drain time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" {
+		return nil
+	}
+	l.draining = true
+
+	if drain > 0 {
+		start := monotime()
+		ttl := strconv.FormatInt(int64(drain/time.Millisecond), 10)
+		if err := eval(l.client, luaRefresh, []string{l.key}, append([]interface{}{l.value, ttl, ResetTTL.String()}, l.legacyValue()...)...).Err(); err != nil {
+			return err
+		}
+		l.setExpiry(start, drain)
+	} else if err := l.release(); err != nil {
+		return err
+	}
+
+	return eval(l.client, luaPublish, nil, eventsChannel(l.key), EventReleasing).Err()
+}
+
+// DrainOnSignal calls Drain once any of the given signals (default: SIGINT
+// and SIGTERM) is received. Errors are passed to the optional onError.
+// Call the returned function to stop listening.
+func (l *Locker) DrainOnSignal(drain time.Duration, onError func(error), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = defaultDrainSignals
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		defer signal.Stop(ch)
+
+		select {
+		case <-ch:
+			if err := l.Drain(drain); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-done:
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func eventsChannel(key string) string {
+	return key + ":events"
+}
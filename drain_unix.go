@@ -0,0 +1,10 @@
+//go:build !windows
+
+package lock
+
+import (
+	"os"
+	"syscall"
+)
+
+var defaultDrainSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
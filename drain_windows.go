@@ -0,0 +1,5 @@
+package lock
+
+import "os"
+
+var defaultDrainSignals = []os.Signal{os.Interrupt}
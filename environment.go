@@ -0,0 +1,39 @@
+package lock
+
+import (
+	"errors"
+
+	"github.com/go-redis/redis"
+)
+
+// MetaEnvironment is the metadata key of the environment tag
+const MetaEnvironment = "env"
+
+// ErrEnvironmentMismatch is returned by Lock() if the lock is held by
+// a locker tagged with a different Options.Environment
+var ErrEnvironmentMismatch = errors.New("lock held by a different environment")
+
+// checkEnvironment returns ErrEnvironmentMismatch if the current holder
+// is tagged with a different environment. Untagged holders are accepted.
+func (l *Locker) checkEnvironment() error {
+	if l.opts.Environment == "" {
+		return nil
+	}
+
+	l.cost.script()
+	raw, err := eval(l.client, luaGet, []string{l.key}).String()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	v, err := l.opts.Codec.Decode(raw)
+	if err != nil {
+		return nil
+	}
+	if env := v.Metadata[MetaEnvironment]; env != "" && env != l.opts.Environment {
+		return ErrEnvironmentMismatch
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+//go:build !nolua
+
+package lock
+
+import "github.com/go-redis/redis"
+
+// scriptsEnabled is false if the package was built with the nolua tag
+const scriptsEnabled = true
+
+// eval runs a script, using FCALL or EVALSHA if preloaded
+func eval(client RedisClient, src string, keys []string, args ...interface{}) *redis.Cmd {
+	if cmd, ok := fcall(client, src, keys, args...); ok {
+		return cmd
+	}
+	if sha, ok := pinnedSHAs.Load(src); ok {
+		if evaler, ok := client.(shaEvaler); ok {
+			cmd := evaler.EvalSha(sha.(string), keys, args...)
+			if err := cmd.Err(); err == nil || !isNoScript(err) {
+				return cmd
+			}
+		}
+	}
+	return client.Eval(src, keys, args...)
+}
+
+// evalPiped enqueues a script on pipe like eval. The returned function
+// resolves the result once pipe was executed, it falls back to EVAL on
+// client if the preloaded script or function went missing.
+func evalPiped(pipe redis.Pipeliner, client RedisClient, src string, keys []string, args ...interface{}) func() *redis.Cmd {
+	var cmd *redis.Cmd
+	if _, ok := functionClients.Load(client); ok && !sharded(client) {
+		cmd = pipe.Do(fcallArgs(src, keys, args...)...)
+	} else if sha, ok := pinnedSHAs.Load(src); ok {
+		cmd = pipe.EvalSha(sha.(string), keys, args...)
+	} else {
+		cmd = pipe.Eval(src, keys, args...)
+	}
+
+	return func() *redis.Cmd {
+		if err := cmd.Err(); err != nil && (isNoScript(err) || isFunctionNotFound(err)) {
+			return eval(client, src, keys, args...)
+		}
+		return cmd
+	}
+}
@@ -0,0 +1,108 @@
+//go:build nolua
+
+package lock
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis"
+)
+
+// scriptsEnabled is false if the package was built with the nolua tag
+const scriptsEnabled = false
+
+// eval emulates the core scripts with plain commands, for Redis offerings
+// which reject EVAL. Ownership checks are not atomic: if a lock expires
+// between GET and DEL/PEXPIRE, the previous holder may release or refresh
+// the lock of its successor. All other operations fail with
+// ErrScriptsDisabled.
+func eval(client RedisClient, src string, keys []string, args ...interface{}) *redis.Cmd {
+	c, ok := client.(doer)
+	if !ok {
+		return redis.NewCmdResult(nil, ErrCommandsUnsupported)
+	}
+
+	switch src {
+	case luaGet:
+		return c.Do("get", keys[0])
+	case luaSetPX:
+		return c.Do("set", keys[0], args[0], "px", args[1])
+	case luaDel:
+		return c.Do("del", keys[0])
+	case luaPTTL:
+		return c.Do("pttl", keys[0])
+	case luaObtain:
+		return c.Do("set", keys[0], args[0], "nx", "px", args[1])
+	case luaDequeue:
+		return c.Do("zrem", keys[0], args[0])
+	case luaQueueLength:
+		return c.Do("zcard", keys[0])
+	case luaRepairTTL:
+		if pttl, err := c.Do("pttl", keys[0]).Int64(); err != nil || pttl != -1 {
+			return redis.NewCmdResult(int64(0), err)
+		}
+		return c.Do("pexpire", keys[0], args[0])
+	case luaStatus:
+		v, err := c.Do("get", keys[0]).Result()
+		if err != nil {
+			return redis.NewCmdResult(nil, err)
+		}
+		pttl, err := c.Do("pttl", keys[0]).Int64()
+		return redis.NewCmdResult([]interface{}{v, pttl}, err)
+	case luaRelease:
+		if ok, err := holds(c, keys[0], args...); !ok {
+			return redis.NewCmdResult(int64(0), err)
+		}
+		return c.Do("del", keys[0])
+	case luaRefresh:
+		values := []interface{}{args[0]}
+		if len(args) > 3 {
+			values = append(values, args[3])
+		}
+		if ok, err := holds(c, keys[0], values...); !ok {
+			return redis.NewCmdResult(int64(0), err)
+		}
+		switch args[2] {
+		case KeepTTL.String():
+			return redis.NewCmdResult(int64(1), nil)
+		case ExtendBy.String():
+			pttl, err := c.Do("pttl", keys[0]).Int64()
+			if err != nil {
+				return redis.NewCmdResult(nil, err)
+			}
+			if pttl > 0 {
+				ttl, err := strconv.ParseInt(fmt.Sprint(args[1]), 10, 64)
+				if err != nil {
+					return redis.NewCmdResult(nil, err)
+				}
+				return c.Do("pexpire", keys[0], pttl+ttl)
+			}
+		}
+		return c.Do("pexpire", keys[0], args[1])
+	}
+	return redis.NewCmdResult(nil, fmt.Errorf("%w: %s", ErrScriptsDisabled, scripts[src]))
+}
+
+// holds reports whether key holds one of values
+func holds(c doer, key string, values ...interface{}) (bool, error) {
+	v, err := c.Do("get", key).String()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, value := range values {
+		if v == fmt.Sprint(value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// evalPiped runs the emulated script on client right away, the emulation
+// cannot be pipelined
+func evalPiped(_ redis.Pipeliner, client RedisClient, src string, keys []string, args ...interface{}) func() *redis.Cmd {
+	cmd := eval(client, src, keys, args...)
+	return func() *redis.Cmd { return cmd }
+}
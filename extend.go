@@ -0,0 +1,49 @@
+package lock
+
+import (
+	"strconv"
+	"time"
+)
+
+const luaExtendIfExpiring = `local v = redis.call("get", KEYS[1])
+if v ~= ARGV[1] and v ~= ARGV[4] then return 0 end
+if redis.call("pttl", KEYS[1]) > tonumber(ARGV[2]) then return 2 end
+redis.call("pexpire", KEYS[1], ARGV[3])
+return 1`
+
+// ExtendIfExpiringWithin atomically extends the lock to ttl, but only if
+// its remaining TTL is at most threshold. It returns true if the lock is
+// still held (whether it was extended or not) and false if it was lost.
+func (l *Locker) ExtendIfExpiringWithin(threshold, ttl time.Duration) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" {
+		if l.State() == Released {
+			l.misuse("ExtendIfExpiringWithin", "already released")
+		}
+		return false, nil
+	}
+
+	start := monotime()
+	status, err := eval(l.client, luaExtendIfExpiring, []string{l.key}, append([]interface{}{l.value,
+		strconv.FormatInt(int64(threshold/time.Millisecond), 10),
+		strconv.FormatInt(int64(ttl/time.Millisecond), 10),
+	}, l.legacyValue()...)...).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	switch status {
+	case 1:
+		l.setExpiry(start, ttl)
+		l.audit(AuditRefreshed)
+		l.heartbeat()
+		return true, l.track()
+	case 2:
+		return true, nil
+	}
+	l.setState(Lost)
+	l.reset()
+	return false, nil
+}
@@ -0,0 +1,28 @@
+package lock
+
+// Factory creates lockers for arbitrary keys, sharing a client and
+// pre-normalized options. Scripts need no per-factory caching, they are
+// shared by all lockers and can be preloaded once with PreloadScripts.
+type Factory struct {
+	client RedisClient
+	opts   Options
+}
+
+// NewFactory creates a new factory
+func NewFactory(client RedisClient, opts *Options) *Factory {
+	if opts == nil {
+		opts = new(Options)
+	}
+	o := *opts
+	return &Factory{client: client, opts: *o.normalize()}
+}
+
+// For creates a new lock on key
+func (f *Factory) For(key string) *Locker {
+	return newLocker(f.client, key, f.opts)
+}
+
+// Options returns a copy of the factory options
+func (f *Factory) Options() Options {
+	return f.opts
+}
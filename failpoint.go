@@ -0,0 +1,34 @@
+package lock
+
+// Failpoint identifies an internal decision point, see Options.Failpoint
+type Failpoint string
+
+// Available failpoints
+const (
+	// BeforeAcquire is triggered before each acquisition attempt
+	BeforeAcquire Failpoint = "before-acquire"
+	// AfterAcquire is triggered after the lock was set in Redis,
+	// but before Lock() returns. Failing here simulates a lost response.
+	AfterAcquire Failpoint = "after-acquire"
+	// BeforeRefresh is triggered before a held lock is refreshed
+	BeforeRefresh Failpoint = "before-refresh"
+	// BeforeRelease is triggered before a lock is released
+	BeforeRelease Failpoint = "before-release"
+)
+
+// FailAt returns an Options.Failpoint func which fails with err at fp
+func FailAt(fp Failpoint, err error) func(Failpoint) error {
+	return func(at Failpoint) error {
+		if at == fp {
+			return err
+		}
+		return nil
+	}
+}
+
+func (l *Locker) failpoint(fp Failpoint) error {
+	if l.opts.Failpoint == nil {
+		return nil
+	}
+	return l.opts.Failpoint(fp)
+}
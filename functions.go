@@ -0,0 +1,95 @@
+package lock
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// FunctionLibrary is the name of the Redis Functions library, see LoadFunctions
+const FunctionLibrary = "redislock"
+
+// functionClients holds the clients for which LoadFunctions succeeded
+var functionClients sync.Map
+
+// LoadFunctions registers all Lua scripts as a Redis Functions library
+// (Redis 7+). Once loaded, lock operations on client use FCALL and fall
+// back to EVALSHA/EVAL transparently if the library is missing (e.g. after
+// a failover to a server without it). Other clients are not affected.
+func LoadFunctions(ctx context.Context, client RedisClient) error {
+	c, ok := client.(doer)
+	if !ok {
+		return ErrCommandsUnsupported
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := c.Do("function", "load", "replace", functionLibrary()).Err(); err != nil {
+		return err
+	}
+	functionClients.Store(client, struct{}{})
+	return nil
+}
+
+// functionLibrary returns the source of the library
+func functionLibrary() string {
+	srcs := make([]string, 0, len(scripts))
+	for src := range scripts {
+		srcs = append(srcs, src)
+	}
+	sort.Slice(srcs, func(i, j int) bool { return functionName(srcs[i]) < functionName(srcs[j]) })
+
+	var b strings.Builder
+	b.WriteString("#!lua name=" + FunctionLibrary + "\n")
+	for _, src := range srcs {
+		b.WriteString("redis.register_function('" + functionName(src) + "', function(KEYS, ARGV)\n")
+		b.WriteString(src)
+		b.WriteString("\nend)\n")
+	}
+	return b.String()
+}
+
+// functionName returns the function name of a script, e.g. "lock_refresh"
+func functionName(src string) string {
+	return strings.NewReplacer(":", "_", "-", "_").Replace(scripts[src])
+}
+
+// fcall calls the function registered for src, if available
+func fcall(client RedisClient, src string, keys []string, args ...interface{}) (*redis.Cmd, bool) {
+	// Sharded clients cannot route FCALL by key
+	if _, ok := functionClients.Load(client); !ok || sharded(client) {
+		return nil, false
+	}
+
+	c, ok := client.(doer)
+	if !ok {
+		return nil, false
+	}
+
+	cmd := c.Do(fcallArgs(src, keys, args...)...)
+	if err := cmd.Err(); isFunctionNotFound(err) {
+		functionClients.Delete(client)
+		return nil, false
+	}
+	return cmd, true
+}
+
+// fcallArgs returns the FCALL command for src
+func fcallArgs(src string, keys []string, args ...interface{}) []interface{} {
+	cmdArgs := make([]interface{}, 0, 3+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, "fcall", functionName(src), strconv.Itoa(len(keys)))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	return append(cmdArgs, args...)
+}
+
+// isFunctionNotFound reports whether err means that the library is missing
+func isFunctionNotFound(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "ERR Function not found")
+}
@@ -0,0 +1,6 @@
+//go:build !lockdebug
+
+package lock
+
+// goroutineID returns zero, goroutines are only tracked in lockdebug builds
+func goroutineID() uint64 { return 0 }
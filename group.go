@@ -0,0 +1,102 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Group is a group of goroutines working under a lock, similar to
+// golang.org/x/sync/errgroup, see Locker.Group
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// Group returns a group whose context is cancelled as soon as the lock is
+// lost, a goroutine of the group returns an error or Wait returns. The lock
+// is refreshed in the background until Wait returns, but not released.
+func (l *Locker) Group(ctx context.Context) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	go g.watch(l)
+	return g
+}
+
+// Context returns the context of the group
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a new goroutine. The first error cancels the group
+// and is returned by Wait.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		if err := fn(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all goroutines returned. It returns the first error,
+// or ErrLockLost if the lock was lost or could not be refreshed in time.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	<-g.done
+	return g.err
+}
+
+func (g *Group) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// watch refreshes the lock and fails the group once it is lost, or once
+// refreshes failed repeatedly or beyond the local expiry of the lock
+func (g *Group) watch(l *Locker) {
+	defer close(g.done)
+
+	ticker := time.NewTicker(l.opts.LockTimeout / 2)
+	defer ticker.Stop()
+
+	token := l.currentToken()
+	failures := 0
+	for {
+		if token == "" {
+			g.fail(ErrLockLost)
+			return
+		}
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := l.extend()
+			if err != nil {
+				if failures++; failures > 1 || !l.ProbablyHeld() {
+					g.fail(fmt.Errorf("%w: %v", ErrLockLost, err))
+					return
+				}
+				continue
+			}
+			failures = 0
+
+			// A lock which was lost and obtained again is lost, too
+			if !ok || l.currentToken() != token {
+				token = ""
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+// handoffs tracks waiters and acquisitions per key within this process,
+// see Options.SyncHandoff
+var handoffs = struct {
+	keys map[string]*handoff
+	mu   sync.Mutex
+}{keys: make(map[string]*handoff)}
+
+type handoff struct {
+	waiters  int
+	released chan struct{} // closed to wake up waiters
+	acquired chan struct{} // closed once a waiter acquired the lock
+}
+
+// handoffState returns the state of key, handoffs.mu must be held
+func handoffState(key string) *handoff {
+	h, ok := handoffs.keys[key]
+	if !ok {
+		h = &handoff{released: make(chan struct{}), acquired: make(chan struct{})}
+		handoffs.keys[key] = h
+	}
+	return h
+}
+
+// handoffWaiting registers a waiter for key, the returned func unregisters it
+func handoffWaiting(key string) func() {
+	handoffs.mu.Lock()
+	handoffState(key).waiters++
+	handoffs.mu.Unlock()
+
+	return func() {
+		handoffs.mu.Lock()
+		defer handoffs.mu.Unlock()
+
+		if h := handoffState(key); h.waiters > 1 {
+			h.waiters--
+		} else {
+			delete(handoffs.keys, key)
+		}
+	}
+}
+
+// handoffReleased returns a channel which is closed on the next release of key
+func handoffReleased(key string) <-chan struct{} {
+	handoffs.mu.Lock()
+	defer handoffs.mu.Unlock()
+
+	return handoffState(key).released
+}
+
+// handoffAcquired signals that a waiter acquired key
+func handoffAcquired(key string) {
+	handoffs.mu.Lock()
+	defer handoffs.mu.Unlock()
+
+	h := handoffState(key)
+	close(h.acquired)
+	h.acquired = make(chan struct{})
+}
+
+// beginHandoff must be called before key is released. If there are
+// waiters, it returns a func which wakes them up and blocks until one of
+// them acquired the lock, for at most timeout.
+func beginHandoff(key string, timeout time.Duration) func() {
+	handoffs.mu.Lock()
+	defer handoffs.mu.Unlock()
+
+	h, ok := handoffs.keys[key]
+	if !ok || h.waiters == 0 {
+		return nil
+	}
+	acquired := h.acquired
+
+	return func() {
+		handoffs.mu.Lock()
+		close(h.released)
+		h.released = make(chan struct{})
+		handoffs.mu.Unlock()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-acquired:
+		case <-timer.C:
+		}
+	}
+}
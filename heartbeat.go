@@ -0,0 +1,70 @@
+package lock
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Heartbeat is written to key + ":heartbeat" whenever
+// a lock is acquired or refreshed, see Options.Heartbeat
+type Heartbeat struct {
+	// Token is the token of the holder
+	Token string `json:"token"`
+
+	// Metadata is the holder metadata, see Options.Metadata
+	Metadata map[string]string `json:"meta,omitempty"`
+
+	// At is the time of the heartbeat
+	At time.Time `json:"at"`
+
+	// Grace is the Options.HeartbeatGrace of the holder
+	Grace time.Duration `json:"grace,omitempty"`
+}
+
+// LastHeartbeat returns the last heartbeat of the current holder of key,
+// or ErrNotLocked if there is none. With Options.HeartbeatGrace, it returns
+// the heartbeat of the last holder for a while after the lock has expired.
+func LastHeartbeat(client RedisClient, key string) (*Heartbeat, error) {
+	raw, err := eval(client, luaGet, []string{heartbeatKey(key)}).String()
+	if err == redis.Nil {
+		return nil, ErrNotLocked
+	} else if err != nil {
+		return nil, err
+	}
+
+	hb := new(Heartbeat)
+	if err := json.Unmarshal([]byte(raw), hb); err != nil {
+		return nil, err
+	}
+	return hb, nil
+}
+
+// heartbeat writes the companion heartbeat key, errors are ignored
+func (l *Locker) heartbeat() {
+	if !l.opts.Heartbeat {
+		return
+	}
+
+	raw, err := json.Marshal(&Heartbeat{Token: l.token, Metadata: l.meta, At: time.Now(), Grace: l.opts.HeartbeatGrace})
+	if err != nil {
+		return
+	}
+
+	ttl := strconv.FormatInt(int64((l.opts.LockTimeout+l.opts.HeartbeatGrace)/time.Millisecond), 10)
+	_ = eval(l.client, luaSetPX, []string{heartbeatKey(l.key)}, raw, ttl).Err()
+}
+
+// clearHeartbeat removes the heartbeat key, errors are ignored
+func (l *Locker) clearHeartbeat() {
+	if !l.opts.Heartbeat {
+		return
+	}
+	_ = eval(l.client, luaDel, []string{heartbeatKey(l.key)}).Err()
+}
+
+func heartbeatKey(key string) string {
+	return key + ":heartbeat"
+}
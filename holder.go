@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrHolderQuotaExceeded is returned by Lock() if the holder already
+// holds Options.HolderQuota locks
+var ErrHolderQuotaExceeded = errors.New("holder quota exceeded")
+
+const luaTrackPrelude = luaServerTime + `local now = servertime()
+redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+local function track() redis.call("zadd", KEYS[2], now + ARGV[2], KEYS[1]) if redis.call("pttl", KEYS[2]) < tonumber(ARGV[2]) then redis.call("pexpire", KEYS[2], ARGV[2]) end end
+`
+
+const luaObtainTracked = luaTrackPrelude + `if tonumber(ARGV[3]) > 0 and redis.call("zcard", KEYS[2]) >= tonumber(ARGV[3]) then return -1 end
+if not redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2]) then return 0 end
+track()
+return 1`
+
+const luaTrack = luaTrackPrelude + `track() return 1`
+const luaUntrack = `return redis.call("zrem", KEYS[2], KEYS[1])`
+const luaHeldBy = luaServerTime + `return redis.call("zrangebyscore", KEYS[1], "(" .. servertime(), "+inf")`
+
+// HeldBy returns the keys of all locks currently held by holderID,
+// as tracked with Options.HolderID
+func HeldBy(client RedisClient, holderID string) ([]string, error) {
+	res, err := eval(client, luaHeldBy, []string{holderKey(holderID)}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	vals, _ := res.([]interface{})
+	keys := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if key, ok := v.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// obtainTracked acquires the lock and records it in the holder set
+func (l *Locker) obtainTracked(client RedisClient, value string) (bool, error) {
+	status, err := eval(client, luaObtainTracked, l.trackingKeys(), value, l.ttlArg(), l.opts.HolderQuota).Int64()
+	if err != nil {
+		return false, err
+	} else if status == -1 {
+		return false, ErrHolderQuotaExceeded
+	}
+	return status == 1, nil
+}
+
+// track updates the expiry of the lock in the holder set
+func (l *Locker) track() error {
+	if l.opts.HolderID == "" {
+		return nil
+	}
+	return eval(l.client, luaTrack, l.trackingKeys(), "", l.ttlArg()).Err()
+}
+
+// untrack removes the lock from the holder set
+func (l *Locker) untrack() error {
+	if l.opts.HolderID == "" {
+		return nil
+	}
+	return eval(l.client, luaUntrack, l.trackingKeys()).Err()
+}
+
+func (l *Locker) trackingKeys() []string {
+	return []string{l.key, holderKey(l.opts.HolderID)}
+}
+
+func (l *Locker) ttlArg() string {
+	return strconv.FormatInt(int64(l.opts.LockTimeout/time.Millisecond), 10)
+}
+
+func holderKey(holderID string) string {
+	return "lock:holder:" + holderID
+}
@@ -0,0 +1,79 @@
+package lock
+
+import "sort"
+
+const luaObtain = `return redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2])`
+
+// Script describes a Lua script used by this package, so that components
+// written in other languages can perform compatible operations on locks.
+// Lock values are plain tokens, unless a different Options.Codec is used.
+type Script struct {
+	// Name is the operation name, see OperationName
+	Name string
+
+	// Source is the Lua source, for EVAL
+	Source string
+
+	// SHA is the SHA1 digest of Source, for EVALSHA
+	SHA string
+
+	// Keys describes the expected KEYS
+	Keys []string
+
+	// Args describes the expected ARGV
+	Args []string
+}
+
+type scriptSignature struct {
+	keys, args []string
+}
+
+var scriptSignatures = map[string]scriptSignature{
+	luaObtain:           {[]string{"lock"}, []string{"value", "ttl (ms)"}},
+	luaRefresh:          {[]string{"lock"}, []string{"value", "ttl (ms)", "mode (reset, extend, keep)", "legacy value (optional)"}},
+	luaRelease:          {[]string{"lock"}, []string{"value", "legacy value (optional)"}},
+	luaExtendIfExpiring: {[]string{"lock"}, []string{"value", "threshold (ms)", "ttl (ms)", "legacy value (optional)"}},
+	luaStatus:           {[]string{"lock"}, nil},
+	luaGet:              {[]string{"key"}, nil},
+	luaSetPX:            {[]string{"key"}, []string{"value", "ttl (ms)"}},
+	luaDel:              {[]string{"key"}, nil},
+	luaPTTL:             {[]string{"key"}, nil},
+	luaEnqueue:          {[]string{"lock:queue"}, []string{"token", "ttl (ms)"}},
+	luaDequeue:          {[]string{"sorted set"}, []string{"member"}},
+	luaQueueLength:      {[]string{"lock:queue"}, nil},
+	luaAudit:            {[]string{"lock:audit"}, []string{"max length", "event", "token", "ttl (ms)", "correlation id"}},
+	luaAuditRange:       {[]string{"lock:audit"}, []string{"window (ms)"}},
+	luaPublish:          {nil, []string{"channel (lock:events)", "message"}},
+	luaObtainTracked:    {[]string{"lock", "lock:holder:<id>"}, []string{"value", "ttl (ms)", "quota (0 = unlimited)"}},
+	luaTrack:            {[]string{"lock", "lock:holder:<id>"}, []string{"unused", "ttl (ms)"}},
+	luaUntrack:          {[]string{"lock", "lock:holder:<id>"}, nil},
+	luaHeldBy:           {[]string{"lock:holder:<id>"}, nil},
+	luaReapSorted:       {[]string{"sorted set"}, []string{"older than (ms)"}},
+	luaLockedPop:        {[]string{"lock", "list"}, []string{"value", "legacy value (optional)"}},
+	luaIntent:           {[]string{"lock:intents"}, []string{"contender", "ttl (ms)"}},
+	luaMembership:       {[]string{"partitions:members"}, []string{"member", "ttl (ms)"}},
+	luaSchedule:         {[]string{"lock:schedule"}, []string{"id", "delay (ms)", "window (ms)"}},
+	luaYield:            {[]string{"lock", "lock:schedule"}, []string{"value", "own schedule id"}},
+	luaObtainOrYield:    {[]string{"lock", "lock:schedule"}, []string{"value", "ttl (ms)", "own schedule id"}},
+	luaTransfer:         {[]string{"lock", "lock:successors"}, []string{"value", "successor id", "ttl (ms)", "legacy value (optional)"}},
+	luaSuccessorAdd:     {[]string{"lock:successors"}, []string{"successor id", "value", "ttl (ms)"}},
+	luaSuccessorDel:     {[]string{"lock:successors"}, []string{"successor id"}},
+	luaAttempt:          {[]string{"lock:attempts"}, []string{"attempt id", "window (ms)", "limit"}},
+	luaRotate:           {[]string{"lock", "lock:participants", "lock:turn"}, []string{"participant id", "value", "slice (ms)"}},
+	luaObtainPayload:    {[]string{"lock", "lock:payload"}, []string{"value", "ttl (ms)"}},
+	luaReleasePayload:   {[]string{"lock", "lock:payload"}, []string{"value", "payload", "legacy value (optional)"}},
+	luaRepairTTL:        {[]string{"lock"}, []string{"ttl (ms)"}},
+}
+
+// Scripts returns all scripts used by this package, sorted by name.
+// Acquisitions without holder tracking are issued as SET NX, which is
+// equivalent to "lock:obtain" and labelled as such by OperationName.
+func Scripts() []Script {
+	res := make([]Script, 0, len(scripts))
+	for src, name := range scripts {
+		sig := scriptSignatures[src]
+		res = append(res, Script{Name: name, Source: src, SHA: scriptSHA(src), Keys: sig.keys, Args: sig.args})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
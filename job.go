@@ -0,0 +1,44 @@
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrJobLocked is returned by handlers wrapped with RequeueJob if the job
+// is already being processed elsewhere. Return it to the queue framework,
+// so the job is retried later.
+var ErrJobLocked = errors.New("job is locked")
+
+// Contention controls how wrapped job handlers behave if a job is locked
+type Contention int
+
+const (
+	// SkipJob reports the job as done without processing it
+	SkipJob Contention = iota
+	// RequeueJob fails the job with ErrJobLocked
+	RequeueJob
+)
+
+// WrapJob wraps a job handler of an asynchronous worker (e.g. asynq or
+// machinery), so each job is processed under a lock on prefix + id(job).
+// The lock is refreshed in the background while the handler is running and
+// released afterwards. If the job is locked, onContention decides whether
+// it is skipped or requeued.
+func WrapJob[J any](client RedisClient, prefix string, opts *Options, onContention Contention, id func(J) string, handler func(context.Context, J) error) func(context.Context, J) error {
+	return func(ctx context.Context, job J) error {
+		locker := New(client, prefix+id(job), opts)
+		if ok, err := locker.LockContext(ctx); err != nil {
+			return err
+		} else if !ok {
+			if onContention == RequeueJob {
+				return ErrJobLocked
+			}
+			return nil
+		}
+
+		defer locker.keepAliveBackground(ctx)()
+
+		return handler(ctx, job)
+	}
+}
@@ -0,0 +1,71 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidKey is returned when a key cannot be built
+var ErrInvalidKey = errors.New("invalid key")
+
+// DefaultKeyBuilder is used by Key
+var DefaultKeyBuilder = &KeyBuilder{MaxLength: 512}
+
+// KeyBuilder builds validated lock keys
+type KeyBuilder struct {
+	// Namespace is prepended to all keys, e.g. "myapp:locks"
+	Namespace string
+
+	// MaxLength is the maximum length of the resulting key, 0 = unlimited
+	MaxLength int
+
+	// HashTag wraps the key parts into a Redis Cluster hash tag,
+	// so companion keys (queues, heartbeats, ...) map to the same slot,
+	// e.g. "ns:{orders:123}"
+	HashTag bool
+}
+
+// Key builds a key from parts using the DefaultKeyBuilder
+func Key(parts ...string) (string, error) {
+	return DefaultKeyBuilder.Key(parts...)
+}
+
+// Key builds a key from parts. Parts must be non-empty and must not contain
+// whitespace, control characters, separators (':') or braces.
+func (b *KeyBuilder) Key(parts ...string) (string, error) {
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: no parts", ErrInvalidKey)
+	}
+	for _, part := range parts {
+		if err := validateKeyPart(part); err != nil {
+			return "", err
+		}
+	}
+
+	key := strings.Join(parts, ":")
+	if b.HashTag {
+		key = "{" + key + "}"
+	}
+	if b.Namespace != "" {
+		key = b.Namespace + ":" + key
+	}
+
+	if b.MaxLength > 0 && len(key) > b.MaxLength {
+		return "", fmt.Errorf("%w: %q exceeds %d bytes", ErrInvalidKey, key, b.MaxLength)
+	}
+	return key, nil
+}
+
+func validateKeyPart(part string) error {
+	if part == "" {
+		return fmt.Errorf("%w: empty part", ErrInvalidKey)
+	}
+	for _, r := range part {
+		if r == ':' || r == '{' || r == '}' || unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return fmt.Errorf("%w: illegal character %q in %q", ErrInvalidKey, r, part)
+		}
+	}
+	return nil
+}
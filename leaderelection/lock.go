@@ -0,0 +1,134 @@
+// Package leaderelection provides a Redis-backed resourcelock.Interface,
+// so controllers can use k8s.io/client-go/tools/leaderelection with Redis
+// instead of Lease objects.
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const luaCompareAndSet = `if redis.call("get", KEYS[1]) ~= ARGV[1] then return 0 end
+redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+return 1`
+
+var resource = schema.GroupResource{Group: "redis-lock", Resource: "locks"}
+
+// Lock implements resourcelock.Interface. The leader election record is
+// stored as JSON in key and expires after LeaseDurationSeconds, updates are
+// compare-and-set against the last observed record.
+type Lock struct {
+	client   lock.RedisClient
+	key      string
+	identity string
+
+	// OnEvent is called by RecordEvent, if set
+	OnEvent func(string)
+
+	observed []byte
+	mu       sync.Mutex
+}
+
+var _ resourcelock.Interface = (*Lock)(nil)
+
+// New returns a lock for key, identity identifies the candidate
+func New(client lock.RedisClient, key, identity string) *Lock {
+	return &Lock{client: client, key: key, identity: identity}
+}
+
+// Get implements resourcelock.Interface
+func (l *Lock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	raw, err := l.client.Eval(`return redis.call("get", KEYS[1])`, []string{l.key}).String()
+	if err == redis.Nil {
+		return nil, nil, apierrors.NewNotFound(resource, l.key)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var record resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return nil, nil, err
+	}
+
+	l.mu.Lock()
+	l.observed = []byte(raw)
+	l.mu.Unlock()
+
+	return &record, []byte(raw), nil
+}
+
+// Create implements resourcelock.Interface
+func (l *Lock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	ok, err := l.client.SetNX(l.key, raw, leaseDuration(ler)).Result()
+	if err != nil {
+		return err
+	} else if !ok {
+		return apierrors.NewAlreadyExists(resource, l.key)
+	}
+
+	l.mu.Lock()
+	l.observed = raw
+	l.mu.Unlock()
+	return nil
+}
+
+// Update implements resourcelock.Interface
+func (l *Lock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.observed == nil {
+		return errors.New("leader election record not initialized, call Get or Create first")
+	}
+
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	ttl := strconv.FormatInt(int64(leaseDuration(ler)/time.Millisecond), 10)
+	status, err := l.client.Eval(luaCompareAndSet, []string{l.key}, string(l.observed), string(raw), ttl).Int64()
+	if err != nil {
+		return err
+	} else if status != 1 {
+		return apierrors.NewConflict(resource, l.key, errors.New("leader election record was modified"))
+	}
+
+	l.observed = raw
+	return nil
+}
+
+// RecordEvent implements resourcelock.Interface
+func (l *Lock) RecordEvent(event string) {
+	if l.OnEvent != nil {
+		l.OnEvent(event)
+	}
+}
+
+// Identity implements resourcelock.Interface
+func (l *Lock) Identity() string { return l.identity }
+
+// Describe implements resourcelock.Interface
+func (l *Lock) Describe() string { return "redis/" + l.key }
+
+func leaseDuration(ler resourcelock.LeaderElectionRecord) time.Duration {
+	if ler.LeaseDurationSeconds < 1 {
+		return time.Second
+	}
+	return time.Duration(ler.LeaseDurationSeconds) * time.Second
+}
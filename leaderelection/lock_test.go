@@ -0,0 +1,107 @@
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const testRedisKey = "__bsm_redis_lock_leaderelection_unit_test__"
+
+var _ = Describe("Lock", func() {
+	var subject *Lock
+	ctx := context.Background()
+
+	record := func(holder string) resourcelock.LeaderElectionRecord {
+		return resourcelock.LeaderElectionRecord{
+			HolderIdentity:       holder,
+			LeaseDurationSeconds: 10,
+			LeaderTransitions:    1,
+		}
+	}
+
+	BeforeEach(func() {
+		subject = New(redisClient, testRedisKey, "a")
+	})
+
+	It("should describe itself", func() {
+		Expect(subject.Identity()).To(Equal("a"))
+		Expect(subject.Describe()).To(Equal("redis/" + testRedisKey))
+	})
+
+	It("should report missing records as not found", func() {
+		_, _, err := subject.Get(ctx)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should create and get records", func() {
+		Expect(subject.Create(ctx, record("a"))).To(Succeed())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 10*time.Second, time.Second))
+
+		rec, raw, err := New(redisClient, testRedisKey, "b").Get(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.HolderIdentity).To(Equal("a"))
+		Expect(rec.LeaseDurationSeconds).To(Equal(10))
+		Expect(string(raw)).To(Equal(redisClient.Get(testRedisKey).Val()))
+
+		err = New(redisClient, testRedisKey, "b").Create(ctx, record("b"))
+		Expect(apierrors.IsAlreadyExists(err)).To(BeTrue())
+	})
+
+	It("should update observed records", func() {
+		Expect(subject.Update(ctx, record("a"))).To(MatchError(ContainSubstring("not initialized")))
+
+		Expect(subject.Create(ctx, record("a"))).To(Succeed())
+		Expect(subject.Update(ctx, record("a"))).To(Succeed())
+
+		other := New(redisClient, testRedisKey, "b")
+		_, _, err := other.Get(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other.Update(ctx, record("b"))).To(Succeed())
+
+		err = subject.Update(ctx, record("a"))
+		Expect(apierrors.IsConflict(err)).To(BeTrue())
+
+		rec, _, err := subject.Get(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.HolderIdentity).To(Equal("b"))
+		Expect(subject.Update(ctx, record("a"))).To(Succeed())
+	})
+
+	It("should record events", func() {
+		subject.RecordEvent("ignored")
+
+		var events []string
+		subject.OnEvent = func(event string) { events = append(events, event) }
+		subject.RecordEvent("became leader")
+		Expect(events).To(Equal([]string{"became leader"}))
+	})
+})
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	AfterEach(func() {
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+	})
+	RunSpecs(t, "redis-lock/leaderelection")
+}
+
+var redisClient *redis.Client
+
+var _ = BeforeSuite(func() {
+	redisClient = redis.NewClient(&redis.Options{
+		Network: "tcp",
+		Addr:    "127.0.0.1:6379", DB: 9,
+	})
+	Expect(redisClient.Ping().Err()).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	redisClient.Close()
+})
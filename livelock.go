@@ -0,0 +1,54 @@
+package lock
+
+import (
+	"strconv"
+	"time"
+)
+
+const luaIntent = `redis.call("zincrby", KEYS[1], 1, ARGV[1])
+redis.call("pexpire", KEYS[1], ARGV[2])
+return redis.call("zrevrank", KEYS[1], ARGV[1])`
+
+// maxLivelockShift caps the exponential slowdown of contenders
+const maxLivelockShift = 5
+
+// intentID identifies a contender, across Lock() calls if HolderID is set
+func (l *Locker) intentID(token string) string {
+	if l.opts.HolderID != "" {
+		return l.opts.HolderID
+	}
+	return token
+}
+
+// livelockDelay records a failed attempt and returns the retry delay.
+// The contender with the most failed attempts retries at twice the rate,
+// all others back off exponentially by their rank.
+func (l *Locker) livelockDelay(token string) (time.Duration, error) {
+	ttl := strconv.FormatInt(int64((l.opts.WaitTimeout+l.opts.LockTimeout)/time.Millisecond), 10)
+	l.cost.script()
+	rank, err := eval(l.client, luaIntent, []string{intentsKey(l.key)}, l.intentID(token), ttl).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	if rank == 0 {
+		if delay := l.opts.WaitRetry / 2; delay > MinWaitRetry {
+			return delay, nil
+		}
+		return MinWaitRetry, nil
+	}
+	if rank > maxLivelockShift {
+		rank = maxLivelockShift
+	}
+	return l.opts.WaitRetry << uint(rank), nil
+}
+
+// clearIntent removes the contender after a successful acquisition
+func (l *Locker) clearIntent(token string) {
+	l.cost.script()
+	_ = eval(l.client, luaDequeue, []string{intentsKey(l.key)}, l.intentID(token)).Err()
+}
+
+func intentsKey(key string) string {
+	return key + ":intents"
+}
@@ -0,0 +1,45 @@
+package lock
+
+import "time"
+
+// MetaDatacenter is the metadata key of the holder's datacenter
+const MetaDatacenter = "dc"
+
+// localityCheck tracks how long a non-preferred datacenter has observed
+// the key to be free, in monotime
+type localityCheck struct {
+	freeSince time.Duration
+	checkedAt time.Duration
+}
+
+// preferred reports whether the locker may acquire without confirmation
+func (l *Locker) preferred() bool {
+	return l.opts.PreferredDatacenter == "" || l.opts.Datacenter == l.opts.PreferredDatacenter
+}
+
+// confirmLocality reports whether a locker of a non-preferred datacenter may
+// attempt to acquire. The key must have been observed free, without gaps,
+// for Options.FailoverDelay, so the preferred datacenter can re-acquire after
+// brief partitions before the lock flaps across datacenters.
+func (l *Locker) confirmLocality() (bool, error) {
+	if l.preferred() {
+		return true, nil
+	}
+
+	ttl, err := l.keyTTL()
+	if err != nil {
+		return false, err
+	}
+
+	now, prev := monotime(), l.locality
+	l.locality.checkedAt = now
+	if ttl != -2*time.Millisecond { // -2 = missing key
+		l.locality.freeSince = 0
+		return false, nil
+	}
+	if prev.freeSince == 0 || now-prev.checkedAt > l.opts.FailoverDelay {
+		l.locality.freeSince = now
+		return false, nil
+	}
+	return now-prev.freeSince >= l.opts.FailoverDelay, nil
+}
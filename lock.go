@@ -1,21 +1,81 @@
 package lock
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
-const luaRefresh = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
-const luaRelease = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+const luaRefresh = `local v = redis.call("get", KEYS[1])
+if v ~= ARGV[1] and v ~= ARGV[4] then return 0 end
+if ARGV[3] == "keep" then return 1 end
+if ARGV[3] == "extend" then local pttl = redis.call("pttl", KEYS[1]) if pttl > 0 then return redis.call("pexpire", KEYS[1], pttl + ARGV[2]) end end
+return redis.call("pexpire", KEYS[1], ARGV[2])`
+const luaRelease = `local v = redis.call("get", KEYS[1])
+if v == ARGV[1] or v == ARGV[2] then return redis.call("del", KEYS[1]) else return 0 end`
+const luaGet = `return redis.call("get", KEYS[1])`
+const luaSetPX = `return redis.call("set", KEYS[1], ARGV[1], "px", ARGV[2])`
+const luaDel = `return redis.call("del", KEYS[1])`
+const luaPTTL = `return redis.call("pttl", KEYS[1])`
 
 var ErrCannotGetLock = errors.New("cannot get lock")
 
+// ErrAlreadyReleased is returned by Unlock() with FailDoubleUnlock
+// if the lock was already released
+var ErrAlreadyReleased = errors.New("lock already released")
+
+// ErrLockLost is returned by Lock() with Options.StrictOwnership if
+// the lock expired or was taken over by someone else
+var ErrLockLost = errors.New("lock lost")
+
+// LockError is returned when a lock cannot be obtained because
+// it is held by someone else
+type LockError struct {
+	// Key is the contended lock key
+	Key string
+
+	// RetryAfter is the remaining TTL of the current holder, as observed
+	// after the last failed attempt. Zero if unknown.
+	RetryAfter time.Duration
+
+	// QueuePosition is the number of waiters that were ahead of us
+	// (only with Options.MaxQueueDepth)
+	QueuePosition int
+
+	// HolderMetadata is the metadata of the current holder, as observed
+	// after the last failed attempt (only with a Codec which stores metadata)
+	HolderMetadata map[string]string
+}
+
+// Error implements error
+func (e *LockError) Error() string {
+	msg := ErrCannotGetLock.Error()
+	if e.RetryAfter > 0 {
+		msg += ", retry after " + e.RetryAfter.String()
+	}
+	if len(e.HolderMetadata) != 0 {
+		pairs := make([]string, 0, len(e.HolderMetadata))
+		for k, v := range e.HolderMetadata {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		msg += ", held by " + strings.Join(pairs, " ")
+	}
+	return msg
+}
+
+// Unwrap allows errors.Is(err, ErrCannotGetLock)
+func (e *LockError) Unwrap() error { return ErrCannotGetLock }
+
 // RedisClient is a minimal client interface
 type RedisClient interface {
 	SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd
@@ -28,28 +88,101 @@ type Locker struct {
 	key    string
 	opts   Options
 
-	token string
-	mutex sync.Mutex
+	token      string
+	value      string
+	meta       map[string]string
+	retryAfter time.Duration
+	holderMeta map[string]string
+	queuePos   int
+	successor  *successor
+	payload    *payloadRead
+	reentered  string
+	clock      clockReading
+	locality   localityCheck
+	observed   ttlReading
+	cost       costCounter
+	goroutine  uint64
+	scheduleID string
+	draining   bool
+	state      int32
+	expiry     int64
+	verifiedAt int64
+	progressAt int64
+	trace      *traceRing
+	mutex      sync.Mutex
 }
 
-// RunWithLock run some code with Redis Locker
-func RunWithLock(client RedisClient, key string, opts *Options, handler func() error) error {
-	locker, err := ObtainLock(client, key, opts)
+// RunWithLock run some code with Redis Locker. With Options.ExecutionTimeout,
+// the lock is refreshed in the background while handler runs, but released
+// once the timeout is exceeded, see RunWithLockContext.
+func RunWithLock(client RedisClient, key string, opts *Options, handler func() error) (err error) {
+	if opts != nil && opts.ExecutionTimeout > 0 {
+		return RunWithLockContext(context.Background(), client, key, opts, func(context.Context) error { return handler() })
+	}
+
+	var locker *Locker
+	profile(context.Background(), opts, key, "waiting", func(context.Context) { locker, err = ObtainLock(client, key, opts) })
 	if err != nil {
 		return err
 	}
 	defer locker.Unlock()
-	return handler()
+
+	profile(context.Background(), opts, key, "held", func(context.Context) { err = handler() })
+	return err
+}
+
+// TryRunWithLock attempts to obtain the lock once, without waiting, and runs
+// handler if successful. It reports whether handler ran, a lock held by
+// someone else is not an error.
+func TryRunWithLock(client RedisClient, key string, opts *Options, handler func() error) (bool, error) {
+	once := opts.Merge(nil)
+	once.WaitTimeout, once.RetriesCount = 0, 0
+
+	locker := New(client, key, once)
+	if ok, err := locker.Lock(); err != nil || !ok {
+		return false, err
+	}
+	defer locker.Unlock()
+
+	var err error
+	profile(context.Background(), opts, key, "held", func(context.Context) { err = handler() })
+	return true, err
+}
+
+// RunWithResolver is like RunWithLock, but resolves the options by key
+func RunWithResolver(client RedisClient, key string, resolve OptionsResolver, handler func() error) error {
+	return RunWithLock(client, key, resolve(key), handler)
+}
+
+// Run runs fn with Redis Locker and returns its result
+func Run[T any](client RedisClient, key string, opts *Options, fn func() (T, error)) (T, error) {
+	var res T
+	err := RunWithLock(client, key, opts, func() (err error) {
+		res, err = fn()
+		return
+	})
+	return res, err
 }
 
 // ObtainLock is a shortcut for New().Locker()
-// if we can't get a lock, we return error `ErrCannotGetLock`
+// if we can't get a lock, we return error `ErrCannotGetLock`, use
+// New().Lock() and Locker.LockError() for details on the holder
 func ObtainLock(client RedisClient, key string, opts *Options) (*Locker, error) {
+	locker, err := obtainLock(client, key, opts)
+	if _, ok := err.(*LockError); ok {
+		return nil, ErrCannotGetLock
+	}
+	return locker, err
+}
+
+// obtainLock is like ObtainLock, but returns a `*LockError` if we can't
+// get a lock
+func obtainLock(client RedisClient, key string, opts *Options) (*Locker, error) {
 	locker := New(client, key, opts)
 	if ok, err := locker.Lock(); err != nil {
 		return nil, err
 	} else if !ok {
-		return nil, ErrCannotGetLock
+		return nil, locker.LockError()
 	}
 	return locker, nil
 }
@@ -59,107 +192,614 @@ func New(client RedisClient, key string, opts *Options) *Locker {
 	if opts == nil {
 		opts = new(Options)
 	}
-	return &Locker{client: client, key: key, opts: *opts.normalize()}
+	return newLocker(client, key, *opts.normalize())
+}
+
+// newLocker creates a lock with normalized options
+func newLocker(client RedisClient, key string, opts Options) *Locker {
+	l := &Locker{client: client, key: key, opts: opts}
+	if opts.DebugTrace > 0 {
+		l.trace = &traceRing{entries: make([]TraceEntry, opts.DebugTrace)}
+	}
+	return l
 }
 
-// IsLocked returns true if a lock is acquired
+// Options returns a copy of the effective, normalized options
+func (l *Locker) Options() Options {
+	return l.opts
+}
+
+// IsLocked returns true if a lock is acquired. For reentered locks (see
+// Options.Reentrant), it checks that the original holder still holds it.
 func (l *Locker) IsLocked() bool {
 	l.mutex.Lock()
-	locked := l.token != ""
+	defer l.mutex.Unlock()
+
+	if l.reentered != "" {
+		ok, _ := l.verifyReentered()
+		return ok
+	}
+	return l.token != ""
+}
+
+// legacyValue returns the plain token as optional script argument,
+// see Options.AcceptLegacyValues
+func (l *Locker) legacyValue() []interface{} {
+	return l.legacyArgs(l.value, l.token)
+}
+
+// legacyArgs returns token as optional script argument for value
+func (l *Locker) legacyArgs(value, token string) []interface{} {
+	if !l.opts.AcceptLegacyValues || value == token {
+		return nil
+	}
+	return []interface{}{token}
+}
+
+// currentToken returns the token of the held lock, if any
+func (l *Locker) currentToken() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.token
+}
+
+// RetryAfter returns the remaining TTL of the holder which blocked
+// the last failed Lock() attempt, zero if unknown or if the lock is held
+func (l *Locker) RetryAfter() time.Duration {
+	l.mutex.Lock()
+	retryAfter := l.retryAfter
 	l.mutex.Unlock()
 
-	return locked
+	return retryAfter
 }
 
 // Locker applies the lock, don't forget to defer the Unlock() function to release the lock after usage
 func (l *Locker) Lock() (bool, error) {
+	return l.LockContext(context.Background())
+}
+
+// LockContext is like Lock, but stops waiting as soon as ctx is done
+func (l *Locker) LockContext(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
+	var (
+		ok  bool
+		err error
+	)
+	l.checkClock()
+	if l.sharedGoroutine() {
+		l.misuse("Lock", "shared across goroutines")
+	}
 	if l.token != "" {
-		return l.refresh()
+		ok, err = l.refresh(ctx)
+	} else if l.reentered != "" {
+		ok, err = l.verifyReentered()
+	} else if ok, err = l.create(ctx); ok && l.opts.StrictMode {
+		l.goroutine = goroutineID()
 	}
-	return l.create()
+	recordError(err)
+	return ok, err
 }
 
-// Unlock releases the lock
+// Unlock releases the lock, see Options.DoubleUnlock for repeated calls
 func (l *Locker) Unlock() error {
 	l.mutex.Lock()
+	if l.token == "" && l.State() == Released {
+		l.mutex.Unlock()
+		return l.doubleUnlock()
+	}
+	if l.opts.StrictMode && l.token == "" && l.reentered == "" && l.State() == Unlocked {
+		l.mutex.Unlock()
+		l.misuse("Unlock", "not locked")
+	} else if l.sharedGoroutine() {
+		l.mutex.Unlock()
+		l.misuse("Unlock", "shared across goroutines")
+	}
 	err := l.release()
 	l.mutex.Unlock()
 
+	recordError(err)
 	return err
 }
 
 // Helpers
 
-func (l *Locker) create() (bool, error) {
+func (l *Locker) doubleUnlock() error {
+	switch l.opts.DoubleUnlock {
+	case FailDoubleUnlock:
+		return ErrAlreadyReleased
+	case PanicDoubleUnlock:
+		panic(ErrAlreadyReleased)
+	}
+	return nil
+}
+
+// LockError describes the holder which blocked the last failed Lock()
+// attempt, as far as known. The returned error wraps ErrCannotGetLock.
+func (l *Locker) LockError() *LockError {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return &LockError{Key: l.key, RetryAfter: l.retryAfter, QueuePosition: l.queuePos, HolderMetadata: l.holderMeta}
+}
+
+func (l *Locker) create(ctx context.Context) (bool, error) {
 	l.reset()
+	defer l.cost.begin()()
+	defer func() { l.observed = ttlReading{} }()
 
-	// Create a random token
-	token, err := randomToken()
+	l.setState(Acquiring)
+	defer func() {
+		if l.token == "" && l.reentered == "" {
+			l.setState(Unlocked)
+		}
+	}()
+
+	if err := l.opts.Validate(); err != nil {
+		return false, err
+	}
+	if err := checkTTLPolicy(l.opts.LockTimeout); err != nil {
+		return false, err
+	}
+	if err := l.checkSharding(); err != nil {
+		return false, err
+	}
+	if err := l.checkDB(); err != nil {
+		return false, err
+	}
+
+	// Re-adopt a lock persisted by a previous process
+	if ok, err := l.adoptToken(); err != nil || ok {
+		return ok, err
+	}
+
+	atomic.AddInt64(&stats.pending, 1)
+	defer atomic.AddInt64(&stats.pending, -1)
+
+	token, value, meta, err := l.newValue(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	// Calculate the timestamp we are willing to wait for
-	stop := time.Now().Add(l.opts.WaitTimeout)
+	// Calculate the timestamp we are willing to wait for, within budget
+	start, wait := time.Now(), l.opts.WaitTimeout
+	if budget := BudgetFromContext(ctx); budget != nil {
+		wait = budget.limit(wait)
+		defer func() { budget.consume(time.Since(start)) }()
+	}
+	stop := start.Add(wait)
 	retries := l.opts.RetriesCount
+	queued := false
+
+	// Reuse a single timer for all retries
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	var (
+		lastErr  error
+		delay    time.Duration
+		intended bool
+		attempt  int
+		released <-chan struct{}
+	)
+	if l.opts.SyncHandoff > 0 && wait > 0 {
+		defer handoffWaiting(l.key)()
+	}
 	for {
 		// Try to obtain a lock
-		ok, err := l.obtain(token)
+		attempt++
+		attemptStart := monotime()
+		l.observed = ttlReading{}
+		retry := attempt > 1
+		ok, err := l.obtain(value, retry)
+		if ok && retry && (!scriptsEnabled || !l.plainAcquire()) && l.yieldToSchedule(value) {
+			ok = false
+		}
+		transferred := false
+		if !ok && err == nil && l.successor != nil {
+			ok, err = l.adoptTransfer(value)
+			transferred = ok
+		}
+		var decision RetryDecision
 		if err != nil {
+			decision = l.opts.classify(err)
+		}
+		if err != nil && !decision.Retry {
+			l.traceAttempt(attempt, ok, err, TraceError, 0)
 			return false, err
 		} else if ok {
-			l.token = token
+			if queued {
+				_ = l.dequeue(token)
+			}
+			if intended {
+				l.clearIntent(token)
+			}
+			if l.successor != nil {
+				l.unregisterSuccessor()
+			}
+			if err := l.failpoint(AfterAcquire); err != nil {
+				return false, err
+			}
+			// Transferred locks were already taken over by adopt
+			if !transferred {
+				l.acquired(token, value, meta, attemptStart)
+			}
+			l.persistToken()
+			l.traceAttempt(attempt, ok, nil, TraceAcquired, 0)
+			if l.opts.SyncHandoff > 0 && attempt > 1 {
+				handoffAcquired(l.key)
+			}
 			return true, nil
 		}
 
-		if time.Now().Add(l.opts.WaitRetry).After(stop) {
+		lastErr = err
+
+		// Reenter locks held by our owner
+		if err == nil && attempt == 1 {
+			if holderToken, ok := l.reenter(); ok {
+				l.reentered = holderToken
+				l.setState(Held)
+				return true, nil
+			}
+		}
+
+		// Refuse to contend with holders from other environments
+		if err == nil {
+			if err := l.checkEnvironment(); err != nil {
+				l.traceAttempt(attempt, ok, nil, TraceMismatch, 0)
+				return false, err
+			}
+		}
+
+		// Register as a waiter and give up if the queue is too long
+		if err == nil && l.opts.MaxQueueDepth > 0 {
+			if l.queuePos, err = l.enqueue(token); err != nil {
+				return false, err
+			}
+			queued = true
+			if l.queuePos >= l.opts.MaxQueueDepth {
+				l.traceAttempt(attempt, ok, nil, TraceQueueFull, 0)
+				break
+			}
+		}
+
+		remaining := time.Until(stop)
+		if remaining < l.opts.WaitRetry {
+			l.traceAttempt(attempt, ok, err, TraceTimeout, 0)
 			break
 		}
 
 		if l.opts.RetriesCount > 0 && retries <= 0 {
+			l.traceAttempt(attempt, ok, err, TraceExhausted, 0)
 			break
 		}
 
+		// Calculate the delay, but don't sleep beyond the stop time
+		if l.opts.AntiLivelock && err == nil {
+			if delay, err = l.livelockDelay(token); err != nil {
+				return false, err
+			}
+			intended = true
+		} else if decision.Delay > 0 {
+			delay = decision.Delay
+		} else {
+			delay = l.retryDelay(delay, err)
+		}
+		if delay < 0 {
+			delay = 0
+		} else if delay > remaining {
+			delay = remaining
+		}
+		l.traceAttempt(attempt, ok, lastErr, TraceRetry, delay)
+
+		if l.opts.SyncHandoff > 0 {
+			released = handoffReleased(l.key)
+		}
+
 		retries--
-		time.Sleep(l.opts.WaitRetry)
+		if timer == nil {
+			timer = time.NewTimer(delay)
+		} else {
+			timer.Reset(delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			l.traceAttempt(attempt, ok, lastErr, TraceCanceled, 0)
+		case <-timer.C:
+			continue
+		case <-released:
+			continue
+		}
+		break
+	}
+
+	if queued {
+		_ = l.dequeue(token)
+	}
+	if intended && l.opts.HolderID == "" {
+		l.clearIntent(token)
+	}
+	if lastErr != nil {
+		return false, lastErr
+	}
+
+	// Remember who holds the lock and for how long
+	l.checkTTL()
+	l.retryAfter = l.holderTTL()
+	if holder, ok := l.holder(); ok {
+		if holder.Token == token {
+			atomic.AddInt64(&stats.tokenCollisions, 1)
+			return false, ErrTokenCollision
+		}
+		l.holderMeta = holder.Metadata
 	}
 	return false, nil
 }
 
-func (l *Locker) refresh() (bool, error) {
+// acquired records the lock obtained with value by an attempt started at
+// start (see monotime)
+func (l *Locker) acquired(token, value string, meta map[string]string, start time.Duration) {
+	atomic.AddInt64(&stats.held, 1)
+	l.token = token
+	l.value = value
+	l.meta = meta
+	l.setExpiry(start, l.opts.LockTimeout)
+	l.setState(Held)
+	l.audit(AuditAcquired)
+	l.heartbeat()
+}
+
+// newValue creates a random token and encodes the value to store. A
+// registered successor reuses its registered value.
+func (l *Locker) newValue(ctx context.Context) (token, value string, meta map[string]string, err error) {
+	if s := l.successor; s != nil {
+		return s.token, s.value, s.meta, l.registerSuccessor()
+	}
+
+	if token, err = l.newToken(); err != nil {
+		return
+	}
+	if meta, err = l.metadata(ctx); err != nil {
+		return
+	}
+	value, err = l.opts.Codec.Encode(Value{Token: token, Metadata: meta})
+	return
+}
+
+// retryDelay returns the delay before the next attempt
+func (l *Locker) retryDelay(prev time.Duration, err error) time.Duration {
+	if l.opts.AdaptiveRetry && err == nil {
+		if ttl := l.holderTTL(); ttl > 0 {
+			return ttl + adaptiveRetrySlack
+		}
+	}
+	return l.opts.Backoff(l.opts.WaitRetry, prev)
+}
+
+func (l *Locker) refresh(ctx context.Context) (bool, error) {
+	if ok, err := l.renew(); err != nil || ok {
+		return ok, err
+	}
+
+	if l.opts.StrictOwnership {
+		l.setState(Unlocked)
+		return false, ErrLockLost
+	}
+	return l.create(ctx)
+}
+
+// renew refreshes the held lock, it never creates a new one. If the lock
+// was lost, the locker is reset and left in the Lost state.
+func (l *Locker) renew() (bool, error) {
+	if err := l.failpoint(BeforeRefresh); err != nil {
+		return false, err
+	}
+	if l.deadmanExpired() {
+		_ = l.release()
+		return false, ErrDeadman
+	}
+
+	l.setState(Refreshing)
+	start := monotime()
 	ttl := strconv.FormatInt(int64(l.opts.LockTimeout/time.Millisecond), 10)
-	status, err := l.client.Eval(luaRefresh, []string{l.key}, l.token, ttl).Result()
+	var status interface{}
+	err := l.withTopologyRetry(func() (err error) {
+		status, err = eval(l.client, luaRefresh, []string{l.key}, append([]interface{}{l.value, ttl, l.opts.RefreshMode.String()}, l.legacyValue()...)...).Result()
+		return
+	})
 	if err != nil {
+		l.setState(Held)
 		return false, err
 	} else if status == int64(1) {
-		return true, nil
+		return true, l.refreshed(start)
+	}
+	l.setState(Lost)
+	l.reset()
+	return false, nil
+}
+
+// refreshed records a successful refresh started at start (see monotime)
+func (l *Locker) refreshed(start time.Duration) error {
+	l.extendExpiry(start)
+	l.setState(Held)
+	l.audit(AuditRefreshed)
+	l.heartbeat()
+	return l.track()
+}
+
+func (l *Locker) obtain(value string, retry bool) (bool, error) {
+	if err := l.failpoint(BeforeAcquire); err != nil {
+		return false, err
+	}
+	if err := l.opts.Breaker.allow(); err != nil {
+		return false, err
+	}
+	if err := l.limitAttempt(); err != nil {
+		return false, err
+	}
+	if ok, err := l.confirmLocality(); err != nil || !ok {
+		return false, err
+	}
+
+	var ok bool
+	l.cost.attempt()
+	start := time.Now()
+	err := l.withTopologyRetry(func() (err error) {
+		ok, err = l.setNX(value, retry)
+		return
+	})
+	l.observed = ttlReading{} // the key may have changed
+	l.opts.Breaker.record(time.Since(start), err)
+	return ok, err
+}
+
+func (l *Locker) setNX(value string, retry bool) (bool, error) {
+	if l.opts.MinReplicas > 0 {
+		return l.obtainReplicated(value)
+	}
+	if retry && scriptsEnabled && l.plainAcquire() && l.schedulable() {
+		return l.obtainOrYield(value)
 	}
-	return l.create()
+	return l.acquire(l.client, value)
 }
 
-func (l *Locker) obtain(token string) (bool, error) {
-	ok, err := l.client.SetNX(l.key, token, l.opts.LockTimeout).Result()
+// acquire issues a single acquisition attempt on client
+func (l *Locker) acquire(client RedisClient, value string) (bool, error) {
+	if l.opts.Rotation != "" {
+		l.cost.script()
+		return l.rotate(client, value)
+	}
+	if l.opts.HolderID != "" {
+		l.cost.script()
+		return l.obtainTracked(client, value)
+	}
+	if l.payload != nil {
+		l.cost.script()
+		return l.obtainPayload(client, value)
+	}
+
+	l.cost.command()
+	ok, err := client.SetNX(l.key, value, l.opts.LockTimeout).Result()
 	if err == redis.Nil {
 		err = nil
 	}
 	return ok, err
 }
 
+func (l *Locker) holderTTL() time.Duration {
+	ttl, err := l.keyTTL()
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// pttler is implemented by clients which support PTTL natively
+type pttler interface {
+	PTTL(key string) *redis.DurationCmd
+}
+
+// pttl returns the remaining TTL of key like PTTL, i.e. -1ms if key has no
+// expiry and -2ms if it does not exist
+func pttl(client RedisClient, key string) (time.Duration, error) {
+	if c, ok := client.(pttler); ok {
+		return c.PTTL(key).Result()
+	}
+	ms, err := eval(client, luaPTTL, []string{key}).Int64()
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func (l *Locker) holder() (Value, bool) {
+	l.cost.script()
+	raw, err := eval(l.client, luaGet, []string{l.key}).String()
+	if err != nil {
+		return Value{}, false
+	}
+	v, err := l.opts.Codec.Decode(raw)
+	return v, err == nil
+}
+
 func (l *Locker) release() error {
 	defer l.reset()
 
-	err := l.client.Eval(luaRelease, []string{l.key}, l.token).Err()
+	if l.reentered != "" {
+		l.setState(Released)
+		return nil
+	}
+	if err := l.failpoint(BeforeRelease); err != nil {
+		l.setState(Unlocked)
+		return err
+	}
+
+	var handoff func()
+	if l.opts.SyncHandoff > 0 {
+		handoff = beginHandoff(l.key, l.opts.SyncHandoff)
+	}
+
+	status, err := eval(l.client, luaRelease, []string{l.key}, append([]interface{}{l.value}, l.legacyValue()...)...).Result()
 	if err == redis.Nil {
 		err = nil
+	} else if status == int64(1) && handoff != nil {
+		defer handoff()
+	}
+	return l.afterRelease(status == int64(1), err)
+}
+
+// afterRelease cleans up after a release attempt, released reports whether
+// the lock was deleted
+func (l *Locker) afterRelease(released bool, err error) error {
+	if released {
+		l.audit(AuditReleased)
+		l.clearHeartbeat()
+	}
+	l.releasedState(released, err)
+	if err == nil {
+		l.removeToken()
+	}
+	if err == nil && l.token != "" {
+		err = l.untrack()
 	}
 	return err
 }
 
+// releasedState transitions the state after a release attempt
+func (l *Locker) releasedState(released bool, err error) {
+	switch {
+	case released:
+		l.setState(Released)
+	case err == nil && l.token != "":
+		l.setState(Lost)
+	default:
+		l.setState(Unlocked)
+	}
+}
+
 func (l *Locker) reset() {
+	if l.token != "" {
+		atomic.AddInt64(&stats.held, -1)
+	}
 	l.token = ""
+	l.value = ""
+	l.meta = nil
+	l.retryAfter = 0
+	atomic.StoreInt64(&l.expiry, 0)
+	atomic.StoreInt64(&l.verifiedAt, 0)
+	l.holderMeta = nil
+	l.reentered = ""
+	l.queuePos = 0
+	l.draining = false
 }
 
 func randomToken() (string, error) {
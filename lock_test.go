@@ -1,7 +1,20 @@
 package lock
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -41,11 +54,43 @@ var _ = Describe("Locker", func() {
 			WaitTimeout:  -1,
 		})
 		Expect(locker.opts.RetriesCount).To(Equal(0))
-		Expect(locker.opts.LockTimeout).To(Equal(minLockTimeout))
-		Expect(locker.opts.WaitRetry).To(Equal(minWaitRetry))
+		Expect(locker.opts.LockTimeout).To(Equal(DefaultLockTimeout))
+		Expect(locker.Options().LockTimeout).To(Equal(DefaultLockTimeout))
+		Expect(locker.opts.WaitRetry).To(Equal(MinWaitRetry))
 		Expect(locker.opts.WaitTimeout).To(Equal(time.Duration(0)))
 	})
 
+	It("should merge options", func() {
+		defaults := &Options{LockTimeout: time.Second, WaitRetry: time.Second}
+		merged := defaults.Merge(&Options{LockTimeout: time.Minute, RetriesCount: 3})
+		Expect(merged.LockTimeout).To(Equal(time.Minute))
+		Expect(merged.WaitRetry).To(Equal(time.Second))
+		Expect(merged.RetriesCount).To(Equal(3))
+		Expect(defaults.LockTimeout).To(Equal(time.Second))
+
+		resolve := PerKeyOptions(defaults, map[string]*Options{testRedisKey: {LockTimeout: 2 * time.Second}})
+		Expect(resolve("other").LockTimeout).To(Equal(time.Second))
+		Expect(RunWithResolver(redisClient, testRedisKey, resolve, func() error {
+			Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 2*time.Second, 10*time.Millisecond))
+			return nil
+		})).To(Succeed())
+	})
+
+	It("should compute decorrelated jitter", func() {
+		backoff := DecorrelatedJitter(time.Second)
+		delay := time.Duration(0)
+		for i := 0; i < 100; i++ {
+			next := backoff(10*time.Millisecond, delay)
+			Expect(next).To(BeNumerically(">=", 10*time.Millisecond))
+			Expect(next).To(BeNumerically("<=", time.Second))
+			if delay > 10*time.Millisecond {
+				Expect(next).To(BeNumerically("<", 3*delay))
+			}
+			delay = next
+		}
+		Expect(ConstantBackoff(10*time.Millisecond, time.Second)).To(Equal(10 * time.Millisecond))
+	})
+
 	It("should fail with `can't get lock`", func() {
 		locker := newLock()
 		locker.Lock()
@@ -54,71 +99,2147 @@ var _ = Describe("Locker", func() {
 		Expect(err).To(Equal(ErrCannotGetLock))
 	})
 
-	It("should o btain through short-cut", func() {
-		locker, err := ObtainLock(redisClient, testRedisKey, nil)
-		Expect(err).NotTo(HaveOccurred())
-		Expect(locker).To(BeAssignableToTypeOf(subject))
+	It("should report when to retry", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.PExpire(testRedisKey, 500*time.Millisecond).Err()).NotTo(HaveOccurred())
+
+		locker := New(redisClient, testRedisKey, nil)
+		Expect(locker.Lock()).To(BeFalse())
+		err := locker.LockError()
+		Expect(err).To(MatchError(ErrCannotGetLock))
+		Expect(err.Key).To(Equal(testRedisKey))
+		Expect(err.RetryAfter).To(BeNumerically("~", 500*time.Millisecond, 10*time.Millisecond))
+	})
+
+	It("should o btain through short-cut", func() {
+		locker, err := ObtainLock(redisClient, testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locker).To(BeAssignableToTypeOf(subject))
+	})
+
+	It("should obtain fresh locks", func() {
+		ok, err := subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(subject.IsLocked()).To(BeTrue())
+
+		val := redisClient.Get(testRedisKey).Val()
+		Expect(val).To(HaveLen(24))
+
+		ttl := redisClient.PTTL(testRedisKey).Val()
+		Expect(ttl).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+	})
+
+	It("should wait for expiring locks if WaitTimeout is set", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.PExpire(testRedisKey, 50*time.Millisecond).Err()).NotTo(HaveOccurred())
+
+		ok, err := subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(subject.IsLocked()).To(BeTrue())
+
+		val := redisClient.Get(testRedisKey).Val()
+		Expect(val).To(HaveLen(24))
+		Expect(subject.token).To(Equal(val))
+
+		ttl := redisClient.PTTL(testRedisKey).Val()
+		Expect(ttl).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+	})
+
+	It("should wait until WaitTimeout is reached, then give up", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.PExpire(testRedisKey, 150*time.Millisecond).Err()).NotTo(HaveOccurred())
+
+		ok, err := subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(subject.IsLocked()).To(BeFalse())
+		Expect(subject.token).To(Equal(""))
+
+		val := redisClient.Get(testRedisKey).Val()
+		Expect(val).To(Equal("ABCD"))
+
+		ttl := redisClient.PTTL(testRedisKey).Val()
+		Expect(ttl).To(BeNumerically("~", 50*time.Millisecond, 10*time.Millisecond))
+	})
+
+	It("should stop waiting when the context is cancelled", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		subject.opts.WaitTimeout = time.Second
+		subject.opts.WaitRetry = 500 * time.Millisecond
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		ok, err := subject.LockContext(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(ok).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("~", 50*time.Millisecond, 20*time.Millisecond))
+	})
+
+	It("should not wait for expiring locks if WaitTimeout is not set", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.PExpire(testRedisKey, 150*time.Millisecond).Err()).NotTo(HaveOccurred())
+		subject.opts.WaitTimeout = 0
+
+		ok, err := subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(subject.IsLocked()).To(BeFalse())
+
+		ttl := redisClient.PTTL(testRedisKey).Val()
+		Expect(ttl).To(BeNumerically("~", 150*time.Millisecond, 10*time.Millisecond))
+	})
+
+	It("should give up when the wait queue is too long", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.PExpire(testRedisKey, 150*time.Millisecond).Err()).NotTo(HaveOccurred())
+		opts := &Options{WaitTimeout: 100 * time.Millisecond, MaxQueueDepth: 1}
+
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := New(redisClient, testRedisKey, opts).Lock()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		}()
+
+		Eventually(func() (int, error) {
+			return QueueLength(redisClient, testRedisKey)
+		}).Should(Equal(1))
+
+		start := time.Now()
+		waiter := New(redisClient, testRedisKey, opts)
+		Expect(waiter.Lock()).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+		Expect(waiter.LockError().QueuePosition).To(Equal(1))
+
+		wg.Wait()
+		Expect(QueueLength(redisClient, testRedisKey)).To(Equal(0))
+	})
+
+	It("should preload scripts and fall back after flush", func() {
+		Expect(PreloadScripts(context.Background(), redisClient)).To(Succeed())
+		for src := range scripts {
+			sha, ok := pinnedSHAs.Load(src)
+			Expect(ok).To(BeTrue())
+			Expect(redisClient.ScriptExists(sha.(string)).Val()).To(Equal([]bool{true}))
+		}
+
+		ok, err := subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		Expect(redisClient.ScriptFlush().Err()).NotTo(HaveOccurred())
+		ok, err = subject.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(subject.Unlock()).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should name lock operations", func() {
+		var names []string
+		client := redis.NewClient(redisClient.Options())
+		defer client.Close()
+		client.WrapProcess(func(old func(redis.Cmder) error) func(redis.Cmder) error {
+			return func(cmd redis.Cmder) error {
+				if name, ok := OperationName(cmd); ok {
+					names = append(names, name)
+				}
+				return old(cmd)
+			}
+		})
+
+		locker := New(client, testRedisKey, nil)
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Unlock()).To(Succeed())
+		Expect(names).To(Equal([]string{"lock:obtain", "lock:refresh", "lock:release"}))
+	})
+
+	It("should only call functions on clients which loaded them", func() {
+		loaded := redis.NewClient(redisClient.Options())
+		defer loaded.Close()
+		functionClients.Store(loaded, struct{}{})
+		defer functionClients.Delete(loaded)
+
+		var cmds []string
+		client := redis.NewClient(redisClient.Options())
+		defer client.Close()
+		client.WrapProcess(func(old func(redis.Cmder) error) func(redis.Cmder) error {
+			return func(cmd redis.Cmder) error {
+				cmds = append(cmds, cmd.Name())
+				return old(cmd)
+			}
+		})
+
+		Expect(eval(client, luaGet, []string{testRedisKey}).Err()).To(Equal(redis.Nil))
+		Expect(cmds).NotTo(BeEmpty())
+		Expect(cmds).NotTo(ContainElement("fcall"))
+	})
+
+	It("should build a function library", func() {
+		lib := functionLibrary()
+		Expect(lib).To(HavePrefix("#!lua name=redislock\n"))
+		Expect(lib).To(ContainSubstring("redis.register_function('lock_refresh', function(KEYS, ARGV)\n" + luaRefresh + "\nend)"))
+		Expect(strings.Count(lib, "redis.register_function(")).To(Equal(len(scripts)))
+	})
+
+	It("should list required commands", func() {
+		Expect(RequiredCommands()).To(ContainElement("eval"))
+		Expect(RequiredCommands()).To(ContainElement("set"))
+		for src, name := range scripts {
+			for _, m := range regexp.MustCompile(`redis\.call\("([a-z]+)"`).FindAllStringSubmatch(src, -1) {
+				Expect(RequiredCommands()).To(ContainElement(m[1]), "used by %s", name)
+			}
+		}
+		Expect((&PermissionError{User: "app", Missing: []string{"eval", "del"}}).Error()).
+			To(Equal("redis user app is missing ACL permissions for: eval, del"))
+	})
+
+	It("should detect missing keyspace notification flags", func() {
+		Expect(missingNotifyFlags("")).To(Equal("Kgx"))
+		Expect(missingNotifyFlags("Ex")).To(Equal("g"))
+		Expect(missingNotifyFlags("KA")).To(Equal(""))
+		Expect(missingNotifyFlags("Kgxz")).To(Equal(""))
+	})
+
+	It("should hold locks until the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		locker, err := LockUntilDone(ctx, redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locker.IsLocked()).To(BeTrue())
+
+		time.Sleep(250 * time.Millisecond)
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(locker.token))
+
+		cancel()
+		Eventually(locker.IsLocked).Should(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should not re-acquire lost locks in the background", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		locker, err := LockUntilDone(ctx, redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(redisClient.Del(testRedisKey).Err()).To(Succeed())
+
+		Eventually(locker.State).Should(Equal(Lost))
+		Expect(locker.IsLocked()).To(BeFalse())
+		Consistently(func() int64 { return redisClient.Exists(testRedisKey).Val() }, 150*time.Millisecond).Should(BeZero())
+	})
+
+	It("should encode values with custom codecs", func() {
+		opts := &Options{Codec: JSONCodec, Metadata: map[string]string{"host": "test"}}
+		locker, err := ObtainLock(redisClient, testRedisKey, opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		val := redisClient.Get(testRedisKey).Val()
+		Expect(val).To(Equal(`{"token":"` + locker.token + `","meta":{"correlation_id":"` + locker.CorrelationID() + `","host":"test"}}`))
+
+		holder, err := Holder(redisClient, testRedisKey, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holder).To(Equal(&Value{Token: locker.token, Metadata: map[string]string{"host": "test", MetaCorrelationID: locker.CorrelationID()}}))
+
+		ok, err := locker.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(val))
+
+		Expect(locker.Unlock()).To(Succeed())
+		_, err = Holder(redisClient, testRedisKey, opts)
+		Expect(err).To(Equal(ErrNotLocked))
+	})
+
+	It("should report status via Locksmith", func() {
+		smith := NewLocksmith(redisClient, &Options{LockTimeout: time.Second})
+		Expect(smith.Status(testRedisKey)).To(Equal(&Status{}))
+
+		locker, err := smith.Obtain(testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, err := smith.Status(testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Locked).To(BeTrue())
+		Expect(status.TTL).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+		Expect(status.Holder.Token).To(Equal(locker.token))
+		Expect(smith.Run(testRedisKey, nil, func() error { return nil })).To(MatchError(ErrCannotGetLock))
+	})
+
+	It("should retry on transient errors", func() {
+		client := &flakyClient{Client: redisClient, failures: 2}
+		locker := New(client, testRedisKey, &Options{WaitTimeout: 100 * time.Millisecond})
+		_, err := locker.Lock()
+		Expect(err).To(MatchError("LOADING Redis is loading the dataset in memory"))
+
+		client.failures = 2
+		locker = New(client, testRedisKey, &Options{WaitTimeout: 100 * time.Millisecond, RetryOnError: true})
+		ok, err := locker.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		client.failures = 100
+		locker = New(client, testRedisKey, &Options{WaitTimeout: 50 * time.Millisecond, RetryOnError: true})
+		_, err = locker.Lock()
+		Expect(err).To(MatchError("LOADING Redis is loading the dataset in memory"))
+	})
+
+	It("should create lockers via factory", func() {
+		factory := NewFactory(redisClient, &Options{LockTimeout: time.Second})
+		Expect(factory.Options().WaitRetry).To(Equal(MinWaitRetry))
+
+		locker := factory.For(testRedisKey)
+		ok, err := locker.Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		ok, err = factory.For(testRedisKey).Lock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(locker.Unlock()).To(Succeed())
+	})
+
+	It("should audit hold intervals", func() {
+		defer redisClient.Del(testRedisKey + ":audit")
+		opts := &Options{Audit: true, LockTimeout: time.Second}
+
+		first := New(redisClient, testRedisKey, opts)
+		Expect(first.Lock()).To(BeTrue())
+		Expect(first.Lock()).To(BeTrue())
+		Expect(first.Unlock()).To(Succeed())
+
+		report, err := AuditExclusivity(context.Background(), redisClient, testRedisKey, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Holds).To(HaveLen(1))
+		Expect(report.Overlaps).To(BeEmpty())
+
+		// simulate a double-hold
+		second := New(redisClient, testRedisKey, opts)
+		Expect(second.Lock()).To(BeTrue())
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		third := New(redisClient, testRedisKey, opts)
+		Expect(third.Lock()).To(BeTrue())
+
+		report, err = AuditExclusivity(context.Background(), redisClient, testRedisKey, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Holds).To(HaveLen(3))
+		Expect(report.Overlaps).To(HaveLen(1))
+		Expect(report.Overlaps[0].First.Token).To(Equal(second.token))
+		Expect(report.Overlaps[0].Second.Token).To(Equal(third.token))
+	})
+
+	It("should write heartbeats", func() {
+		opts := &Options{Heartbeat: true, Metadata: map[string]string{"pod": "x"}}
+		locker := New(redisClient, testRedisKey, opts)
+		Expect(locker.Lock()).To(BeTrue())
+
+		hb, err := LastHeartbeat(redisClient, testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hb.Token).To(Equal(locker.token))
+		Expect(hb.Metadata).To(HaveKeyWithValue("pod", "x"))
+		Expect(hb.At).To(BeTemporally("~", time.Now(), 10*time.Millisecond))
+
+		time.Sleep(20 * time.Millisecond)
+		Expect(locker.Lock()).To(BeTrue())
+		next, err := LastHeartbeat(redisClient, testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next.At).To(BeTemporally(">", hb.At))
+
+		Expect(locker.Unlock()).To(Succeed())
+		_, err = LastHeartbeat(redisClient, testRedisKey)
+		Expect(err).To(Equal(ErrNotLocked))
+	})
+
+	It("should drain locks", func() {
+		sub := redisClient.Subscribe(testRedisKey + ":events")
+		defer sub.Close()
+		_, err := sub.Receive()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		locker, err := LockUntilDone(ctx, redisClient, testRedisKey, &Options{LockTimeout: time.Second})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locker.Drain(100 * time.Millisecond)).To(Succeed())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 100*time.Millisecond, 10*time.Millisecond))
+
+		msg, err := sub.ReceiveMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Payload).To(Equal(EventReleasing))
+
+		Eventually(func() int64 { return redisClient.Exists(testRedisKey).Val() }).Should(Equal(int64(0)))
+	})
+
+	It("should drain locks regardless of the refresh mode", func() {
+		for _, mode := range []RefreshMode{KeepTTL, ExtendBy} {
+			locker := New(redisClient, testRedisKey, &Options{LockTimeout: time.Second, RefreshMode: mode})
+			Expect(locker.Lock()).To(BeTrue())
+			Expect(locker.Drain(100 * time.Millisecond)).To(Succeed())
+			Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 100*time.Millisecond, 10*time.Millisecond), "%s", mode)
+			Expect(locker.Unlock()).To(Succeed())
+		}
+	})
+
+	It("should build keys", func() {
+		Expect(Key("orders", "123")).To(Equal("orders:123"))
+
+		b := &KeyBuilder{Namespace: "app", HashTag: true, MaxLength: 20}
+		Expect(b.Key("orders", "123")).To(Equal("app:{orders:123}"))
+
+		for _, parts := range [][]string{nil, {"orders", ""}, {"a b"}, {"a:b"}, {"{a}"}, {"a\n"}, {"very-long-order-id"}} {
+			_, err := b.Key(parts...)
+			Expect(err).To(MatchError(ErrInvalidKey), "%q", parts)
+		}
+	})
+
+	It("should enforce holder quotas", func() {
+		defer redisClient.Del(testRedisKey+"2", holderKey("worker"))
+		opts := &Options{HolderID: "worker", HolderQuota: 1}
+
+		first := New(redisClient, testRedisKey, opts)
+		Expect(first.Lock()).To(BeTrue())
+		Expect(first.Lock()).To(BeTrue())
+		Expect(redisClient.ZScore(holderKey("worker"), testRedisKey).Err()).NotTo(HaveOccurred())
+
+		second := New(redisClient, testRedisKey+"2", opts)
+		_, err := second.Lock()
+		Expect(err).To(Equal(ErrHolderQuotaExceeded))
+
+		Expect(first.Unlock()).To(Succeed())
+		Expect(second.Lock()).To(BeTrue())
+		Expect(redisClient.ZRange(holderKey("worker"), 0, -1).Val()).To(Equal([]string{testRedisKey + "2"}))
+	})
+
+	It("should reap stale companion entries", func() {
+		queue := queueKey(testRedisKey)
+		defer redisClient.Del(queue, heartbeatKey(testRedisKey))
+
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		Expect(redisClient.ZAdd(queue, redis.Z{Score: float64(now - 60000), Member: "crashed"}, redis.Z{Score: float64(now), Member: "alive"}).Err()).NotTo(HaveOccurred())
+
+		locker := New(redisClient, testRedisKey, &Options{Heartbeat: true})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+
+		n, err := Reap(context.Background(), redisClient, testRedisKey, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(redisClient.ZRange(queue, 0, -1).Val()).To(Equal([]string{"alive"}))
+		Expect(redisClient.Exists(heartbeatKey(testRedisKey)).Val()).To(Equal(int64(0)))
+	})
+
+	It("should reap stale coordination keys", func() {
+		other := testRedisKey + "2"
+		defer redisClient.Del(attemptsKey(testRedisKey), participantsKey(testRedisKey), scheduleKey(testRedisKey),
+			successorsKey(testRedisKey), intentsKey(testRedisKey), payloadKey(testRedisKey), turnKey(testRedisKey), turnKey(other))
+
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		for _, key := range []string{attemptsKey(testRedisKey), participantsKey(testRedisKey), scheduleKey(testRedisKey)} {
+			Expect(redisClient.ZAdd(key, redis.Z{Score: float64(now - 60000), Member: "crashed"}, redis.Z{Score: float64(now + 60000), Member: "alive"}).Err()).NotTo(HaveOccurred())
+		}
+		Expect(redisClient.HSet(successorsKey(testRedisKey), "standby", "value").Err()).NotTo(HaveOccurred())
+		Expect(redisClient.ZIncrBy(intentsKey(testRedisKey), 1, "contender").Err()).NotTo(HaveOccurred())
+		Expect(redisClient.Set(payloadKey(testRedisKey), "checkpoint", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.Set(turnKey(testRedisKey), "a", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.Set(turnKey(other), "a", 0).Err()).NotTo(HaveOccurred())
+
+		n, err := Reap(context.Background(), redisClient, testRedisKey, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(6))
+		for _, key := range []string{attemptsKey(testRedisKey), participantsKey(testRedisKey), scheduleKey(testRedisKey)} {
+			Expect(redisClient.ZRange(key, 0, -1).Val()).To(Equal([]string{"alive"}), key)
+		}
+		Expect(redisClient.Exists(successorsKey(testRedisKey), intentsKey(testRedisKey), turnKey(other)).Val()).To(Equal(int64(0)))
+		Expect(redisClient.Get(payloadKey(testRedisKey)).Val()).To(Equal("checkpoint"))
+		Expect(redisClient.Get(turnKey(testRedisKey)).Val()).To(Equal("a"))
+
+		Expect(redisClient.HSet(successorsKey(testRedisKey), "standby", "value").Err()).NotTo(HaveOccurred())
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+		Expect(Reap(context.Background(), redisClient, testRedisKey, time.Second)).To(Equal(0))
+		Expect(redisClient.Exists(successorsKey(testRedisKey)).Val()).To(Equal(int64(1)))
+	})
+
+	It("should propagate correlation IDs", func() {
+		defer redisClient.Del(testRedisKey + ":audit")
+		locker := New(redisClient, testRedisKey, &Options{Codec: JSONCodec, Audit: true})
+
+		ctx := ContextWithCorrelationID(context.Background(), "req-1")
+		Expect(locker.LockContext(ctx)).To(BeTrue())
+		Expect(locker.CorrelationID()).To(Equal("req-1"))
+
+		holder, err := Holder(redisClient, testRedisKey, &Options{Codec: JSONCodec})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holder.Metadata).To(HaveKeyWithValue(MetaCorrelationID, "req-1"))
+
+		report, err := AuditExclusivity(context.Background(), redisClient, testRedisKey, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Holds).To(HaveLen(1))
+		Expect(report.Holds[0].CorrelationID).To(Equal("req-1"))
+
+		Expect(locker.Unlock()).To(Succeed())
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.CorrelationID()).NotTo(BeEmpty())
+		Expect(locker.CorrelationID()).NotTo(Equal("req-1"))
+	})
+
+	It("should trigger failpoints", func() {
+		errLost := errors.New("response lost")
+		locker := New(redisClient, testRedisKey, &Options{Failpoint: FailAt(AfterAcquire, errLost)})
+		_, err := locker.Lock()
+		Expect(err).To(Equal(errLost))
+		Expect(locker.IsLocked()).To(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(1)))
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		locker = New(redisClient, testRedisKey, &Options{Failpoint: FailAt(BeforeRelease, errLost)})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Unlock()).To(Equal(errLost))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(1)))
+	})
+
+	It("should encode versioned values", func() {
+		val, err := VersionedCodec.Encode(Value{Token: "tok", Metadata: map[string]string{"pod": "a b", "host": "x"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(val).To(Equal("v2|tok|host=x&pod=a+b"))
+		Expect(VersionedCodec.Decode(val)).To(Equal(Value{Token: "tok", Metadata: map[string]string{"pod": "a b", "host": "x"}, Version: 2}))
+		Expect(VersionedCodec.Decode("v2|tok|")).To(Equal(Value{Token: "tok", Version: 2}))
+		Expect(VersionedCodec.Decode("plain-token")).To(Equal(Value{Token: "plain-token", Version: 1}))
+		_, err = VersionedCodec.Decode("v3|tok|")
+		Expect(err).To(HaveOccurred())
+
+		locker := New(redisClient, testRedisKey, &Options{Codec: VersionedCodec})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(HavePrefix("v2|" + locker.token + "|"))
+		Expect(locker.Unlock()).To(Succeed())
+	})
+
+	It("should classify errors", func() {
+		var classified []error
+		opts := &Options{WaitTimeout: time.Second, ErrorClassifier: func(err error) RetryDecision {
+			classified = append(classified, err)
+			if strings.HasPrefix(err.Error(), "LOADING") {
+				return RetryIn(20 * time.Millisecond)
+			}
+			return Abort()
+		}}
+
+		start := time.Now()
+		Expect(New(&flakyClient{Client: redisClient, failures: 2}, testRedisKey, opts).Lock()).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(classified).To(HaveLen(2))
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+
+		boom := errors.New("boom")
+		_, err := New(&flakyClient{Client: redisClient, failures: 2, err: boom}, testRedisKey, opts).Lock()
+		Expect(err).To(Equal(boom))
+		Expect(classified).To(HaveLen(3))
+	})
+
+	It("should fail fast when the breaker is open", func() {
+		breaker := &Breaker{Threshold: 2, Cooldown: 100 * time.Millisecond}
+		client := &flakyClient{Client: redisClient, failures: 2}
+		opts := &Options{Breaker: breaker}
+
+		for i := 0; i < 2; i++ {
+			_, err := New(client, testRedisKey, opts).Lock()
+			Expect(err).To(MatchError(HavePrefix("LOADING")))
+		}
+
+		_, err := New(client, testRedisKey, opts).Lock()
+		Expect(err).To(Equal(ErrBackendUnhealthy))
+
+		time.Sleep(100 * time.Millisecond)
+		Expect(New(client, testRedisKey, opts).Lock()).To(BeTrue())
+	})
+
+	It("should refresh locks in batches", func() {
+		refresher, err := NewRefresher(redisClient, 10*time.Millisecond, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer refresher.Close()
+
+		defer redisClient.Del(holderKey("batch"), heartbeatKey(testRedisKey))
+
+		opts := &Options{LockTimeout: 100 * time.Millisecond, HolderID: "batch", Heartbeat: true}
+		first := New(redisClient, testRedisKey, opts)
+		second := New(redisClient, testRedisKey+"2", opts)
+		defer second.Unlock()
+		for _, l := range []*Locker{first, second} {
+			Expect(l.Lock()).To(BeTrue())
+			refresher.Add(l)
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(first.value))
+		Expect(redisClient.Get(testRedisKey + "2").Val()).To(Equal(second.value))
+		Expect(HeldBy(redisClient, "batch")).To(ConsistOf(testRedisKey, testRedisKey+"2"))
+		hb, err := LastHeartbeat(redisClient, testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hb.At).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Eventually(first.IsLocked).Should(BeFalse())
+		Expect(refresher.Len()).To(Equal(1))
+	})
+
+	It("should track stats", func() {
+		before := ReadStats()
+		Expect(subject.Lock()).To(BeTrue())
+		Expect(ReadStats().Held).To(Equal(before.Held + 1))
+
+		rec := httptest.NewRecorder()
+		DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/locks", nil))
+		Expect(rec.Body.String()).To(ContainSubstring(`"held":`))
+
+		Expect(subject.Unlock()).To(Succeed())
+		Expect(ReadStats().Held).To(Equal(before.Held))
+
+		_, err := New(&flakyClient{Client: redisClient, failures: 1}, testRedisKey, nil).Lock()
+		Expect(err).To(HaveOccurred())
+		Expect(ReadStats().LastError).To(Equal(err.Error()))
+		Expect(*ReadStats().LastErrorAt).To(BeTemporally("~", time.Now(), time.Second))
+
+		data, err := json.Marshal(Stats{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("last_error"))
+	})
+
+	It("should lock and unlock via pipelines", func() {
+		pipe := redisClient.Pipeline()
+		defer pipe.Close()
+
+		incr := pipe.Incr(testRedisKey + ":counter")
+		defer redisClient.Del(testRedisKey + ":counter")
+		pending, err := subject.LockPipelined(pipe)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subject.IsLocked()).To(BeFalse())
+
+		_, err = pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(incr.Val()).To(Equal(int64(1)))
+		Expect(pending.Result()).To(BeTrue())
+		Expect(subject.IsLocked()).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(subject.value))
+
+		pending = subject.UnlockPipelined(pipe)
+		_, err = pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending.Result()).To(BeTrue())
+		Expect(subject.IsLocked()).To(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should lock and unlock via pipelines like Lock and Unlock", func() {
+		dir, err := os.MkdirTemp("", "redis-lock")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		defer redisClient.Del(holderKey("worker"))
+
+		Expect(PreloadScripts(context.Background(), redisClient)).To(Succeed())
+		Expect(redisClient.ScriptFlush().Err()).NotTo(HaveOccurred())
+
+		locker := New(redisClient, testRedisKey, &Options{HolderID: "worker", TokenFile: filepath.Join(dir, "token")})
+		pipe := redisClient.Pipeline()
+		defer pipe.Close()
+
+		pending, err := locker.LockPipelined(pipe)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pipe.Exec()
+		Expect(err).To(MatchError(HavePrefix("NOSCRIPT")))
+		Expect(pending.Result()).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(locker.value))
+		Expect(HeldBy(redisClient, "worker")).To(Equal([]string{testRedisKey}))
+		Expect(locker.opts.TokenFile).To(BeAnExistingFile())
+
+		pending = locker.UnlockPipelined(pipe)
+		_, err = pipe.Exec()
+		Expect(err).To(MatchError(HavePrefix("NOSCRIPT")))
+		Expect(pending.Result()).To(BeTrue())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+		Expect(HeldBy(redisClient, "worker")).To(BeEmpty())
+		Expect(locker.opts.TokenFile).NotTo(BeAnExistingFile())
+	})
+
+	It("should enforce TTL policies", func() {
+		SetTTLPolicy(time.Second, time.Minute)
+		defer SetTTLPolicy(0, 0)
+
+		_, err := ObtainLock(redisClient, testRedisKey, &Options{LockTimeout: time.Hour})
+		Expect(err).To(MatchError(ErrTTLOutOfBounds))
+		_, err = ObtainLock(redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond})
+		Expect(err).To(MatchError(ErrTTLOutOfBounds))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		Expect(New(redisClient, testRedisKey, &Options{LockTimeout: time.Second}).Lock()).To(BeTrue())
+	})
+
+	It("should sign tokens", func() {
+		secret := []byte("s3cr3t")
+		opts := &Options{TokenSecret: secret}
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeTrue())
+
+		holder, err := Holder(redisClient, testRedisKey, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(VerifyToken(testRedisKey, holder.Token, secret)).To(BeTrue())
+		Expect(VerifyToken(testRedisKey, holder.Token, []byte("other"))).To(BeFalse())
+		Expect(VerifyToken("other", holder.Token, secret)).To(BeFalse())
+
+		Expect(redisClient.Set(testRedisKey, "forged.c2ln", 0).Err()).NotTo(HaveOccurred())
+		_, err = Holder(redisClient, testRedisKey, opts)
+		Expect(err).To(Equal(ErrInvalidToken))
+	})
+
+	It("should encode tokens", func() {
+		Expect(New(redisClient, testRedisKey, &Options{TokenBytes: 32, TokenEncoding: HexToken}).Lock()).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(MatchRegexp(`^[0-9a-f]{64}$`))
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+
+		Expect(New(redisClient, testRedisKey, &Options{TokenBytes: 8}).Lock()).To(BeTrue())
+		Expect(redisClient.Get(testRedisKey).Val()).To(HaveLen(24))
+		Expect(ReadStats().TokenCollisions).To(BeZero())
+	})
+
+	It("should refuse locks held by other environments", func() {
+		Expect(New(redisClient, testRedisKey, &Options{Environment: "staging"}).Lock()).To(BeTrue())
+
+		_, err := New(redisClient, testRedisKey, &Options{Environment: "production", WaitTimeout: time.Second}).Lock()
+		Expect(err).To(Equal(ErrEnvironmentMismatch))
+
+		Expect(New(redisClient, testRedisKey, &Options{Environment: "staging"}).Lock()).To(BeFalse())
+
+		holder, err := Holder(redisClient, testRedisKey, &Options{Codec: VersionedCodec})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holder.Metadata).To(HaveKeyWithValue(MetaEnvironment, "staging"))
+	})
+
+	It("should delay acquisition outside the preferred datacenter", func() {
+		passive := &Options{Datacenter: "b", PreferredDatacenter: "a", FailoverDelay: 200 * time.Millisecond}
+		Expect(New(redisClient, testRedisKey, passive).Lock()).To(BeFalse())
+
+		passive.WaitTimeout = time.Second
+		start := time.Now()
+		locker := New(redisClient, testRedisKey, passive)
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+
+		holder, err := Holder(redisClient, testRedisKey, &Options{Codec: VersionedCodec})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holder.Metadata).To(HaveKeyWithValue(MetaDatacenter, "b"))
+		Expect(locker.Unlock()).To(Succeed())
+
+		Expect(New(redisClient, testRedisKey, &Options{Datacenter: "a", PreferredDatacenter: "a"}).Lock()).To(BeTrue())
+	})
+
+	It("should detect and repair lock keys without TTL", func() {
+		Expect(redisClient.Set(testRedisKey, "manual", 0).Err()).To(Succeed())
+		missing := ReadStats().MissingTTL
+
+		var reports []bool
+		opts := &Options{OnMissingTTL: func(_ string, repaired bool) { reports = append(reports, repaired) }}
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(Equal(-time.Millisecond))
+
+		opts.RepairMissingTTL = true
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically(">", 0))
+		Expect(reports).To(Equal([]bool{false, true}))
+		Expect(ReadStats().MissingTTL).To(Equal(missing + 2))
+	})
+
+	It("should support rings", func() {
+		// Shard b uses DB 10 of the same server, so keys split across
+		// shards end up in different DBs
+		ring := redis.NewRing(&redis.RingOptions{
+			Addrs: map[string]string{"a": "127.0.0.1:6379", "b": "localhost:6379"},
+			DB:    9,
+			OnConnect: func(cn *redis.Conn) error {
+				if strings.Contains(cn.String(), "localhost") {
+					return cn.Select(10).Err()
+				}
+				return nil
+			},
+		})
+		defer ring.Close()
+
+		_, err := ObtainLock(ring, testRedisKey, &Options{Heartbeat: true})
+		Expect(err).To(Equal(ErrKeyNotHashTagged))
+		_, err = ObtainLock(ring, testRedisKey, &Options{HolderID: "worker-1"})
+		Expect(err).To(Equal(ErrHolderTrackingSharded))
+
+		key := "{" + testRedisKey + "}"
+		defer ring.Del(key, heartbeatKey(key))
+
+		var shards []*redis.Client
+		Expect(ring.ForEachShard(func(shard *redis.Client) error {
+			shards = append(shards, shard)
+			return nil
+		})).To(Succeed())
+		Expect(shards).To(HaveLen(2))
+
+		Expect(PreloadScripts(context.Background(), ring)).To(Succeed())
+		for _, shard := range shards {
+			Expect(shard.ScriptExists(scriptSHA(luaRefresh)).Val()).To(Equal([]bool{true}))
+		}
+
+		lock, err := ObtainLock(ring, key, &Options{Heartbeat: true, MaxQueueDepth: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(LastHeartbeat(ring, key)).NotTo(BeNil())
+		for _, shard := range shards {
+			Expect(shard.Exists(heartbeatKey(key)).Val()).To(Equal(shard.Exists(key).Val()))
+		}
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(ring.Exists(key).Val()).To(Equal(int64(0)))
+	})
+
+	It("should try to run with lock", func() {
+		var calls int
+		ran, err := TryRunWithLock(redisClient, testRedisKey, nil, func() error {
+			calls++
+
+			ran, err := TryRunWithLock(redisClient, testRedisKey, &Options{WaitTimeout: time.Second}, func() error {
+				calls++
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ran).To(BeFalse())
+			return errors.New("failed")
+		})
+		Expect(err).To(MatchError("failed"))
+		Expect(ran).To(BeTrue())
+		Expect(calls).To(Equal(1))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should include holder details in lock errors", func() {
+		opts := &Options{Codec: JSONCodec, Metadata: map[string]string{"host": "a"}}
+		Expect(New(redisClient, testRedisKey, opts).LockContext(ContextWithCorrelationID(context.Background(), "req-1"))).To(BeTrue())
+
+		locker := New(redisClient, testRedisKey, &Options{Codec: JSONCodec})
+		Expect(locker.Lock()).To(BeFalse())
+
+		var lockErr *LockError
+		err := error(locker.LockError())
+		Expect(errors.As(err, &lockErr)).To(BeTrue())
+		Expect(lockErr.RetryAfter).To(BeNumerically(">", 4*time.Second))
+		Expect(lockErr.HolderMetadata).To(Equal(map[string]string{"host": "a", MetaCorrelationID: "req-1"}))
+		Expect(err.Error()).To(MatchRegexp(`^cannot get lock, retry after .+, held by correlation_id=req-1 host=a$`))
+	})
+
+	It("should expose lifecycle states", func() {
+		var transitions []string
+		locker := New(redisClient, testRedisKey, &Options{
+			OnStateChange: func(from, to State) {
+				transitions = append(transitions, from.String()+">"+to.String())
+			},
+		})
+		Expect(locker.State()).To(Equal(Unlocked))
+
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.State()).To(Equal(Held))
+		Expect(locker.Lock()).To(BeTrue())
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(locker.Lock()).To(BeFalse())
+		Expect(locker.State()).To(Equal(Unlocked))
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Unlock()).To(Succeed())
+		Expect(locker.State()).To(Equal(Released))
+
+		Expect(transitions).To(Equal([]string{
+			"unlocked>acquiring", "acquiring>held",
+			"held>refreshing", "refreshing>held",
+			"held>refreshing", "refreshing>lost", "lost>acquiring", "acquiring>unlocked",
+			"unlocked>acquiring", "acquiring>held",
+			"held>released",
+		}))
+	})
+
+	It("should list locks held by a holder", func() {
+		defer redisClient.Del(testRedisKey+"2", holderKey("worker-1"))
+
+		Expect(HeldBy(redisClient, "worker-1")).To(BeEmpty())
+
+		opts := &Options{HolderID: "worker-1"}
+		l1, err := ObtainLock(redisClient, testRedisKey, opts)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ObtainLock(redisClient, testRedisKey+"2", opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(HeldBy(redisClient, "worker-1")).To(ConsistOf(testRedisKey, testRedisKey+"2"))
+
+		Expect(l1.Unlock()).To(Succeed())
+		Expect(HeldBy(redisClient, "worker-1")).To(ConsistOf(testRedisKey + "2"))
+		Expect(HeldBy(redisClient, "worker-2")).To(BeEmpty())
+	})
+
+	It("should not re-acquire lost locks with strict ownership", func() {
+		locker := New(redisClient, testRedisKey, &Options{StrictOwnership: true})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Lock()).To(BeTrue())
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		_, err := locker.Lock()
+		Expect(err).To(Equal(ErrLockLost))
+		Expect(locker.IsLocked()).To(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		Expect(locker.Lock()).To(BeTrue())
+	})
+
+	It("should not be affected by clock skew", func() {
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+
+		for _, offset := range []time.Duration{time.Hour, -time.Hour} {
+			start := time.Now()
+			locker := New(&skewedClient{Client: redisClient, offset: offset}, testRedisKey, &Options{
+				WaitTimeout:   100 * time.Millisecond,
+				MaxQueueDepth: 2,
+			})
+			Expect(locker.Lock()).To(BeFalse())
+			Expect(time.Since(start)).To(BeNumerically("~", 100*time.Millisecond, 50*time.Millisecond))
+		}
+		Expect(QueueLength(redisClient, testRedisKey)).To(Equal(0))
+	})
+
+	It("should take over as standby", func() {
+		primary, err := ObtainLock(redisClient, testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		standby := Standby(ctx, redisClient, testRedisKey, &Options{WaitRetry: time.Minute})
+		Consistently(standby, 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(primary.Drain(0)).To(Succeed())
+
+		var locker *Locker
+		Eventually(standby, 50*time.Millisecond).Should(Receive(&locker))
+		Expect(locker.IsLocked()).To(BeTrue())
+		Expect(standby).To(BeClosed())
+		Expect(locker.Unlock()).To(Succeed())
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		standby = Standby(ctx, redisClient, testRedisKey, nil)
+		cancel()
+		Eventually(standby).Should(BeClosed())
+	})
+
+	It("should poll as standby", func() {
+		primary, err := ObtainLock(redisClient, testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer primary.Unlock()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		standby := Standby(ctx, redisClient, testRedisKey, &Options{WaitRetry: time.Minute, StandbyPoll: 50 * time.Millisecond})
+		Consistently(standby, 100*time.Millisecond).ShouldNot(Receive())
+
+		// No notification for plain DELs, unless keyspace events are enabled
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+
+		var locker *Locker
+		Eventually(standby, 200*time.Millisecond).Should(Receive(&locker))
+		Expect(locker.Unlock()).To(Succeed())
+	})
+
+	It("should pop from locked queues", func() {
+		list := testRedisKey + ":items"
+		defer redisClient.Del(list)
+		Expect(redisClient.RPush(list, "a", "b").Err()).NotTo(HaveOccurred())
+
+		locker := New(redisClient, testRedisKey, nil)
+		queue := NewLockedQueue(locker, list)
+		_, _, err := queue.Pop()
+		Expect(err).To(Equal(ErrNotLocked))
+
+		Expect(locker.Lock()).To(BeTrue())
+		item, ok, err := queue.Pop()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(item).To(Equal("a"))
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		_, _, err = queue.Pop()
+		Expect(err).To(Equal(ErrLockLost))
+		Expect(locker.IsLocked()).To(BeFalse())
+		Expect(redisClient.LLen(list).Val()).To(Equal(int64(1)))
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(locker.Lock()).To(BeTrue())
+		item, _, err = queue.Pop()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(item).To(Equal("b"))
+		_, ok, err = queue.Pop()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should report locked executions", func() {
+		report, err := RunWithReport(redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond}, func() error {
+			time.Sleep(180 * time.Millisecond)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Hold).To(BeNumerically(">=", 180*time.Millisecond))
+		Expect(report.Refreshes).To(BeNumerically(">=", 2))
+		Expect(report.Lost).To(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		report, err = RunWithReport(redisClient, testRedisKey, nil, func() error {
+			return redisClient.Set(testRedisKey, "ABCD", 0).Err()
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Lost).To(BeTrue())
+
+		report, err = RunWithReport(redisClient, testRedisKey, &Options{WaitTimeout: 50 * time.Millisecond}, func() error {
+			return nil
+		})
+		Expect(err).To(MatchError(ErrCannotGetLock))
+		Expect(report.Wait).To(BeNumerically("~", 50*time.Millisecond, 20*time.Millisecond))
+	})
+
+	It("should retry adaptively", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 150*time.Millisecond).Err()).NotTo(HaveOccurred())
+
+		var attempts int32
+		start := time.Now()
+		locker := New(redisClient, testRedisKey, &Options{
+			WaitTimeout:   time.Second,
+			WaitRetry:     10 * time.Millisecond,
+			AdaptiveRetry: true,
+			Failpoint: func(fp Failpoint) error {
+				if fp == BeforeAcquire {
+					atomic.AddInt32(&attempts, 1)
+				}
+				return nil
+			},
+		})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("~", 150*time.Millisecond, 50*time.Millisecond))
+		Expect(atomic.LoadInt32(&attempts)).To(BeNumerically("<=", 3))
+	})
+
+	It("should re-adopt persisted tokens", func() {
+		dir, err := os.MkdirTemp("", "redis-lock")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		opts := &Options{TokenFile: filepath.Join(dir, "token")}
+		crashed := New(redisClient, testRedisKey, opts)
+		Expect(crashed.Lock()).To(BeTrue())
+		Expect(opts.TokenFile).To(BeAnExistingFile())
+
+		// Lockers of the same process never adopt the file
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+
+		// Pretend the file was written by a previous process
+		var p persistedToken
+		data, err := os.ReadFile(opts.TokenFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(data, &p)).To(Succeed())
+		p.Process = "previous"
+		p.CRC = p.checksum()
+		data, err = json.Marshal(&p)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(opts.TokenFile, data, 0600)).To(Succeed())
+
+		restarted := New(redisClient, testRedisKey, opts)
+		Expect(restarted.Lock()).To(BeTrue())
+		Expect(restarted.token).To(Equal(crashed.token))
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+
+		Expect(os.WriteFile(opts.TokenFile, []byte(`{"key":"`+testRedisKey+`","token":"x","value":"x","crc":1}`), 0600)).To(Succeed())
+		Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+		Expect(opts.TokenFile).NotTo(BeAnExistingFile())
+
+		Expect(restarted.Unlock()).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should wrap job handlers", func() {
+		type job struct{ ID string }
+		jobID := func(j *job) string { return j.ID }
+
+		var calls int32
+		var skip, requeue func(context.Context, *job) error
+		skip = WrapJob(redisClient, "__bsm_redis_lock_unit_test__:", nil, SkipJob, jobID, func(ctx context.Context, j *job) error {
+			atomic.AddInt32(&calls, 1)
+			Expect(skip(ctx, j)).To(Succeed())
+			Expect(requeue(ctx, j)).To(Equal(ErrJobLocked))
+			return nil
+		})
+		requeue = WrapJob(redisClient, "__bsm_redis_lock_unit_test__:", nil, RequeueJob, jobID, func(ctx context.Context, j *job) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+
+		j := &job{ID: "1"}
+		defer redisClient.Del("__bsm_redis_lock_unit_test__:1")
+
+		Expect(skip(context.Background(), j)).To(Succeed())
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+		Expect(redisClient.Exists("__bsm_redis_lock_unit_test__:1").Val()).To(Equal(int64(0)))
+	})
+
+	It("should share wait budgets", func() {
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+
+		budget := NewBudget(150 * time.Millisecond)
+		ctx := ContextWithBudget(context.Background(), budget)
+		opts := &Options{WaitTimeout: 100 * time.Millisecond}
+
+		start := time.Now()
+		Expect(New(redisClient, testRedisKey, opts).LockContext(ctx)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("~", 100*time.Millisecond, 30*time.Millisecond))
+		Expect(budget.Remaining()).To(BeNumerically("~", 50*time.Millisecond, 30*time.Millisecond))
+
+		start = time.Now()
+		Expect(New(redisClient, testRedisKey, opts).LockContext(ctx)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("~", 50*time.Millisecond, 30*time.Millisecond))
+		Expect(budget.Remaining()).To(BeNumerically("<", 20*time.Millisecond))
+
+		start = time.Now()
+		Expect(New(redisClient, testRedisKey, opts).LockContext(ctx)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Millisecond))
+	})
+
+	It("should detect double unlocks", func() {
+		for mode, assert := range map[DoubleUnlock]func(*Locker){
+			IgnoreDoubleUnlock: func(l *Locker) { Expect(l.Unlock()).To(Succeed()) },
+			FailDoubleUnlock:   func(l *Locker) { Expect(l.Unlock()).To(Equal(ErrAlreadyReleased)) },
+			PanicDoubleUnlock:  func(l *Locker) { Expect(func() { _ = l.Unlock() }).To(PanicWith(ErrAlreadyReleased)) },
+		} {
+			locker := New(redisClient, testRedisKey, &Options{DoubleUnlock: mode})
+			Expect(locker.Unlock()).To(Succeed())
+			Expect(locker.Lock()).To(BeTrue())
+			Expect(locker.Unlock()).To(Succeed())
+			assert(locker)
+
+			Expect(locker.Lock()).To(BeTrue())
+			Expect(locker.Unlock()).To(Succeed())
+		}
+	})
+
+	It("should break livelocks", func() {
+		defer redisClient.Del(intentsKey(testRedisKey))
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.ZAdd(intentsKey(testRedisKey), redis.Z{Score: 10, Member: "service-a"}).Err()).NotTo(HaveOccurred())
+
+		var attempts int32
+		locker := New(redisClient, testRedisKey, &Options{
+			HolderID:     "service-b",
+			WaitTimeout:  200 * time.Millisecond,
+			WaitRetry:    20 * time.Millisecond,
+			AntiLivelock: true,
+			Failpoint: func(fp Failpoint) error {
+				if fp == BeforeAcquire {
+					atomic.AddInt32(&attempts, 1)
+				}
+				return nil
+			},
+		})
+		Expect(locker.Lock()).To(BeFalse())
+
+		// ranked behind service-a, retries every 40ms instead of 20ms
+		Expect(atomic.LoadInt32(&attempts)).To(BeNumerically("<=", 6))
+		Expect(redisClient.ZScore(intentsKey(testRedisKey), "service-b").Val()).To(BeNumerically(">=", 2))
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Unlock()).To(Succeed())
+	})
+
+	It("should apply profiler labels", func() {
+		profile(context.Background(), &Options{ProfilerLabels: true}, testRedisKey, "held", func(ctx context.Context) {
+			key, _ := pprof.Label(ctx, LabelKey)
+			Expect(key).To(Equal(testRedisKey))
+			state, _ := pprof.Label(ctx, LabelState)
+			Expect(state).To(Equal("held"))
+		})
+		profile(context.Background(), nil, testRedisKey, "held", func(ctx context.Context) {
+			_, ok := pprof.Label(ctx, LabelKey)
+			Expect(ok).To(BeFalse())
+		})
+
+		Expect(RunWithLock(redisClient, testRedisKey, &Options{ProfilerLabels: true}, func() error {
+			return nil
+		})).To(Succeed())
+
+		// RunWithLock delegates to RunWithLockContext with ExecutionTimeout
+		opts := &Options{ProfilerLabels: true, ExecutionTimeout: time.Second}
+		Expect(RunWithLockContext(context.Background(), redisClient, testRedisKey, opts, func(ctx context.Context) error {
+			state, _ := pprof.Label(ctx, LabelState)
+			Expect(state).To(Equal("held"))
+			_, ok := ctx.Deadline()
+			Expect(ok).To(BeTrue())
+			return nil
+		})).To(Succeed())
+	})
+
+	It("should validate TTL resolution", func() {
+		_, err := ObtainLock(redisClient, testRedisKey, &Options{LockTimeout: 500 * time.Microsecond})
+		Expect(err).To(MatchError(ErrInvalidTTL))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		locker := New(redisClient, testRedisKey, &Options{LockTimeout: 1500 * time.Microsecond, RoundTTL: true})
+		Expect(locker.opts.LockTimeout).To(Equal(2 * time.Millisecond))
+		Expect(locker.opts.Validate()).To(Succeed())
+
+		month := 30 * 24 * time.Hour
+		locker = New(redisClient, testRedisKey, &Options{LockTimeout: month})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", month, time.Second))
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", month, time.Second))
+	})
+
+	It("should keep heartbeats after expiry", func() {
+		defer redisClient.Del(heartbeatKey(testRedisKey))
+
+		locker := New(redisClient, testRedisKey, &Options{
+			LockTimeout:    50 * time.Millisecond,
+			Heartbeat:      true,
+			HeartbeatGrace: time.Second,
+			Codec:          JSONCodec,
+			Metadata:       map[string]string{"host": "a"},
+		})
+		Expect(locker.Lock()).To(BeTrue())
+		Eventually(func() int64 { return redisClient.Exists(testRedisKey).Val() }).Should(BeZero())
+
+		hb, err := LastHeartbeat(redisClient, testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hb.Metadata).To(HaveKeyWithValue("host", "a"))
+
+		n, err := Reap(context.Background(), redisClient, testRedisKey, time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+		Expect(redisClient.Exists(heartbeatKey(testRedisKey)).Val()).To(Equal(int64(1)))
+	})
+
+	It("should distribute partitions", func() {
+		name := testRedisKey + ":partitions"
+		defer func() {
+			keys, _ := redisClient.Keys(name + ":*").Result()
+			redisClient.Del(keys...)
+		}()
+
+		_, err := NewPartitioner(redisClient, name, 0, "member-0", nil)
+		Expect(err).To(Equal(ErrInvalidPartitions))
+
+		p1, err := NewPartitioner(redisClient, name, 4, "member-1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		p2, err := NewPartitioner(redisClient, name, 4, "member-2", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(p1.Rebalance()).To(Succeed())
+		Expect(p1.Partitions()).To(Equal([]int{0, 1, 2, 3}))
+
+		Expect(p2.Rebalance()).To(Succeed())
+		Expect(p2.Partitions()).To(BeEmpty())
+
+		Expect(p1.Rebalance()).To(Succeed())
+		Expect(p1.Partitions()).To(HaveLen(2))
+		Expect(p2.Rebalance()).To(Succeed())
+		Expect(p2.Partitions()).To(HaveLen(2))
+		Expect(append(p1.Partitions(), p2.Partitions()...)).To(ConsistOf(0, 1, 2, 3))
+
+		Expect(p2.Close()).To(Succeed())
+		Expect(p1.Rebalance()).To(Succeed())
+		Expect(p1.Partitions()).To(Equal([]int{0, 1, 2, 3}))
+		Expect(p1.Close()).To(Succeed())
+	})
+
+	It("should export scripts", func() {
+		exported := Scripts()
+		Expect(exported).To(HaveLen(len(scripts)))
+		for _, s := range exported {
+			Expect(scriptSignatures).To(HaveKey(s.Source), s.Name)
+		}
+
+		byName := make(map[string]Script, len(exported))
+		for _, s := range exported {
+			byName[s.Name] = s
+		}
+		Expect(byName["lock:release"].SHA).To(Equal(scriptSHA(luaRelease)))
+		Expect(redisClient.Eval(byName["lock:obtain"].Source, []string{testRedisKey}, "token", 1000).Err()).NotTo(HaveOccurred())
+		Expect(redisClient.Eval(byName["lock:release"].Source, []string{testRedisKey}, "token").Val()).To(Equal(int64(1)))
+	})
+
+	It("should trace wait loop decisions", func() {
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+
+		lock := New(redisClient, testRedisKey, &Options{DebugTrace: 3, RetriesCount: 4, WaitTimeout: time.Second})
+		Expect(lock.Lock()).To(BeFalse())
+
+		trace := lock.DebugTrace()
+		Expect(trace).To(HaveLen(3))
+		Expect(trace[0].Attempt).To(Equal(3))
+		Expect(trace[0].Action).To(Equal(TraceRetry))
+		Expect(trace[0].Sleep).To(Equal(10 * time.Millisecond))
+		Expect(trace[2].Attempt).To(Equal(5))
+		Expect(trace[2].Action).To(Equal(TraceExhausted))
+		Expect(trace[2].KeyPresent).To(BeTrue())
+		Expect(trace[2].TTL).To(BeNumerically(">", 4*time.Second))
+
+		Expect(New(redisClient, testRedisKey, nil).DebugTrace()).To(BeNil())
+	})
+
+	It("should require logical DBs", func() {
+		Expect(New(redisClient, testRedisKey, &Options{RequireDB: 9}).Lock()).To(BeTrue())
+
+		_, err := New(redisClient, testRedisKey, &Options{RequireDB: 3}).Lock()
+		Expect(err).To(MatchError(ErrDBMismatch))
+		Expect(err).To(MatchError("client uses a different logical DB: want DB 3, got 9"))
+
+		_, err = New(redisClient, testRedisKey, &Options{RequireDB: RequireDefaultDB}).Lock()
+		Expect(err).To(MatchError(ErrDBMismatch))
+	})
+
+	It("should scope locks to tenants", func() {
+		Expect(TenantKey("acme", 1)).To(Equal("tenant:{0}:acme"))
+		Expect(TenantKey("acme", 0)).To(Equal("tenant:{0}:acme"))
+		Expect(TenantKey("acme", 16)).To(Equal(TenantKey("acme", 16)))
+
+		moved := 0
+		for i := 0; i < 1000; i++ {
+			id := strconv.Itoa(i)
+			if TenantKey(id, 10) != TenantKey(id, 11) {
+				Expect(TenantKey(id, 11)).To(HavePrefix("tenant:{10}:"))
+				moved++
+			}
+		}
+		Expect(moved).To(BeNumerically("~", 91, 40))
+
+		tenant := NewTenantLocker(redisClient, "acme", 4, nil)
+		key := tenant.Key("orders")
+		Expect(key).To(Equal(TenantKey("acme", 4) + ":orders"))
+		defer redisClient.Del(key)
+
+		Expect(tenant.For("orders").Lock()).To(BeTrue())
+		Expect(redisClient.Exists(key).Val()).To(Equal(int64(1)))
+		Expect(tenant.RunWithLock("orders", func() error { return nil })).To(Equal(ErrCannotGetLock))
+	})
+
+	It("should obtain locks in transactions", func() {
+		appKey := testRedisKey + ":app"
+		defer redisClient.Del(appKey)
+
+		var locker *Locker
+		Expect(redisClient.Watch(func(tx *redis.Tx) (err error) {
+			locker, err = ObtainInTx(redisClient, tx, testRedisKey, nil, func(pipe redis.Pipeliner) error {
+				return pipe.Set(appKey, "v1", 0).Err()
+			})
+			return err
+		})).To(Succeed())
+		Expect(locker.IsLocked()).To(BeTrue())
+		Expect(redisClient.Get(appKey).Val()).To(Equal("v1"))
+
+		err := redisClient.Watch(func(tx *redis.Tx) error {
+			_, err := ObtainInTx(redisClient, tx, testRedisKey, nil, func(pipe redis.Pipeliner) error {
+				return pipe.Set(appKey, "v2", 0).Err()
+			})
+			return err
+		})
+		Expect(err).To(BeAssignableToTypeOf(&LockError{}))
+		Expect(redisClient.Get(appKey).Val()).To(Equal("v1"))
+		Expect(locker.Unlock()).To(Succeed())
+
+		lock := New(redisClient, testRedisKey, nil)
+		err = redisClient.Watch(func(tx *redis.Tx) error {
+			_, err := lock.LockInTx(tx, func(pipe redis.Pipeliner) error {
+				// Concurrent acquisition after WATCH aborts the transaction
+				Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+				return nil
+			})
+			return err
+		})
+		Expect(err).To(Equal(redis.TxFailedErr))
+		Expect(lock.IsLocked()).To(BeFalse())
+	})
+
+	It("should prioritise scheduled acquisitions", func() {
+		defer redisClient.Del(scheduleKey(testRedisKey))
+		Expect(New(redisClient, testRedisKey, &Options{LockTimeout: 200 * time.Millisecond}).Lock()).To(BeTrue())
+
+		casual := make(chan bool, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			ok, err := New(redisClient, testRedisKey, &Options{WaitTimeout: 500 * time.Millisecond}).Lock()
+			Expect(err).NotTo(HaveOccurred())
+			casual <- ok
+		}()
+
+		scheduled := New(redisClient, testRedisKey, &Options{WaitTimeout: time.Second})
+		done := make(chan bool, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			ok, err := scheduled.LockAfter(50 * time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			done <- ok
+		}()
+		Eventually(func() int64 {
+			return redisClient.ZCard(scheduleKey(testRedisKey)).Val()
+		}).Should(Equal(int64(1)))
+
+		Expect(<-done).To(BeTrue())
+		Expect(<-casual).To(BeFalse())
+		Expect(redisClient.Exists(scheduleKey(testRedisKey)).Val()).To(Equal(int64(0)))
+	})
+
+	It("should not yield after retries without schedules", func() {
+		Expect(New(redisClient, testRedisKey, &Options{LockTimeout: 50 * time.Millisecond}).Lock()).To(BeTrue())
+
+		var names []string
+		client := redis.NewClient(redisClient.Options())
+		defer client.Close()
+		client.WrapProcess(func(old func(redis.Cmder) error) func(redis.Cmder) error {
+			return func(cmd redis.Cmder) error {
+				if name, ok := OperationName(cmd); ok {
+					names = append(names, name)
+				}
+				return old(cmd)
+			}
+		})
+
+		Expect(New(client, testRedisKey, &Options{WaitTimeout: time.Second}).Lock()).To(BeTrue())
+		Expect(names[0]).To(Equal("lock:obtain"))
+		Expect(names[len(names)-1]).To(Equal("lock:obtain-or-yield"))
+		Expect(names).NotTo(ContainElement("lock:yield"))
+	})
+
+	It("should wait for replicas", func() {
+		_, err := New(redisClient, testRedisKey, &Options{MinReplicas: 1, ReplicaTimeout: 10 * time.Millisecond}).Lock()
+		Expect(err).To(Equal(ErrNotReplicated))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		opts := ElastiCacheOptions(1)
+		Expect(opts.MinReplicas).To(Equal(1))
+		Expect(opts.IsRetryable(errors.New("UNBLOCKED force unblock from blocking operation"))).To(BeTrue())
+		Expect(MemoryDBOptions().MinReplicas).To(BeZero())
+
+		client := NewElastiCacheClient("clustercfg.example.cache.amazonaws.com:6379", "token", true)
+		defer client.Close()
+		Expect(client.Options().TLSConfig.ServerName).To(Equal("clustercfg.example.cache.amazonaws.com"))
+		Expect(client.Options().Password).To(Equal("token"))
+	})
+
+	It("should use the default client", func() {
+		defer SetDefaultClient(nil)
+
+		_, err := Obtain(testRedisKey, nil)
+		Expect(err).To(Equal(ErrNoDefaultClient))
+		Expect(RunDefault(testRedisKey, nil, func() error { return nil })).To(Equal(ErrNoDefaultClient))
+
+		SetDefaultClient(redisClient)
+		Expect(DefaultClient()).To(Equal(redisClient))
+
+		ran := false
+		Expect(RunDefault(testRedisKey, nil, func() error {
+			ran = true
+			return nil
+		})).To(Succeed())
+		Expect(ran).To(BeTrue())
+
+		locker, err := Obtain(testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locker.IsLocked()).To(BeTrue())
+	})
+
+	It("should cap concurrent locks per pool", func() {
+		pool := NewPool(redisClient, 1, nil)
+		first, err := pool.Obtain(context.Background(), testRedisKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pool.InUse()).To(Equal(1))
+
+		otherKey := testRedisKey + ":other"
+		defer redisClient.Del(otherKey)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = pool.Obtain(ctx, otherKey)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(redisClient.Exists(otherKey).Val()).To(Equal(int64(0)))
+
+		Expect(first.Unlock()).To(Succeed())
+		Expect(first.Unlock()).To(Succeed())
+		Expect(pool.InUse()).To(Equal(0))
+
+		Expect(pool.RunWithLock(context.Background(), otherKey, func() error {
+			Expect(pool.InUse()).To(Equal(1))
+			return nil
+		})).To(Succeed())
+		Expect(pool.InUse()).To(Equal(0))
+	})
+
+	It("should tell if the lock is probably held", func() {
+		lock := New(redisClient, testRedisKey, &Options{LockTimeout: 50 * time.Millisecond})
+		Expect(lock.ProbablyHeld()).To(BeFalse())
+		Expect(lock.Verify()).To(BeFalse())
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.ProbablyHeld()).To(BeTrue())
+		Expect(lock.Verify()).To(BeTrue())
+
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(lock.ProbablyHeld()).To(BeTrue())
+		Expect(lock.Verify()).To(BeFalse())
+
+		Eventually(lock.ProbablyHeld).Should(BeFalse())
+	})
+
+	It("should tell if the lock is probably held after batched refreshes and drains", func() {
+		refresher, err := NewRefresher(redisClient, 10*time.Millisecond, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer refresher.Close()
+
+		lock := New(redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond})
+		Expect(lock.Lock()).To(BeTrue())
+		refresher.Add(lock)
+		Consistently(lock.ProbablyHeld, 250*time.Millisecond).Should(BeTrue())
+
+		refresher.Remove(lock)
+		Expect(lock.Drain(30 * time.Millisecond)).To(Succeed())
+		Expect(lock.ProbablyHeld()).To(BeTrue())
+		Eventually(lock.ProbablyHeld, 50*time.Millisecond).Should(BeFalse())
+	})
+
+	It("should release locks to successors", func() {
+		defer redisClient.Del(successorsKey(testRedisKey))
+
+		holder := New(redisClient, testRedisKey, nil)
+		Expect(holder.Lock()).To(BeTrue())
+		Expect(holder.ReleaseTo("standby")).To(Equal(ErrNoSuccessor))
+		Expect(holder.IsLocked()).To(BeTrue())
+
+		standby := New(redisClient, testRedisKey, nil)
+		Expect(standby.RegisterSuccessor("standby")).To(Succeed())
+		Expect(standby.Lock()).To(BeFalse())
+
+		Expect(holder.ReleaseTo("standby")).To(Succeed())
+		Expect(holder.IsLocked()).To(BeFalse())
+		Expect(holder.State()).To(Equal(Released))
+
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeFalse())
+		Expect(standby.Lock()).To(BeTrue())
+		Expect(standby.Verify()).To(BeTrue())
+		Expect(redisClient.Exists(successorsKey(testRedisKey)).Val()).To(Equal(int64(0)))
+
+		Expect(standby.Unlock()).To(Succeed())
+		Expect(holder.ReleaseTo("standby")).To(Equal(ErrLockLost))
 	})
 
-	It("should obtain fresh locks", func() {
-		ok, err := subject.Lock()
+	It("should retry topology errors", func() {
+		readonly := errors.New("READONLY You can't write against a read only replica.")
+
+		var events int32
+		opts := &Options{OnTopologyError: func(err error) {
+			Expect(err).To(Equal(readonly))
+			atomic.AddInt32(&events, 1)
+		}}
+		Expect(New(&flakyClient{Client: redisClient, failures: 2, err: readonly}, testRedisKey, opts).Lock()).To(BeTrue())
+		Expect(atomic.LoadInt32(&events)).To(Equal(int32(2)))
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+
+		_, err := New(&flakyClient{Client: redisClient, failures: 2, err: readonly}, testRedisKey, &Options{TopologyRetries: 1}).Lock()
+		Expect(err).To(BeAssignableToTypeOf(&TopologyError{}))
+		Expect(err).To(MatchError(readonly))
+		Expect(IsTransientError(err)).To(BeTrue())
+
+		_, err = New(&flakyClient{Client: redisClient, failures: 1, err: readonly}, testRedisKey, &Options{TopologyRetries: -1}).Lock()
+		Expect(IsTopologyError(err)).To(BeTrue())
+	})
+
+	It("should identify owners across locks", func() {
+		Expect(DefaultOwnerID()).To(MatchRegexp(`^.+:\d+:[0-9a-f]{8}$`))
+		Expect(New(redisClient, testRedisKey, nil).Options().OwnerID).To(Equal(DefaultOwnerID()))
+
+		outer := New(redisClient, testRedisKey, &Options{OwnerID: "worker-1", Codec: JSONCodec})
+		Expect(outer.Lock()).To(BeTrue())
+
+		inner := New(redisClient, testRedisKey, &Options{OwnerID: "worker-1", Reentrant: true, Codec: JSONCodec})
+		Expect(inner.Lock()).To(BeTrue())
+		Expect(inner.IsLocked()).To(BeTrue())
+		Expect(inner.Unlock()).To(Succeed())
+		Expect(outer.Verify()).To(BeTrue())
+
+		// Reentered locks are lost once the original holder releases
+		Expect(inner.Lock()).To(BeTrue())
+		Expect(inner.Lock()).To(BeTrue())
+		Expect(outer.Unlock()).To(Succeed())
+		Expect(inner.IsLocked()).To(BeFalse())
+		Expect(inner.State()).To(Equal(Lost))
+
+		Expect(outer.Lock()).To(BeTrue())
+		Expect(inner.Lock()).To(BeTrue())
+		Expect(outer.Unlock()).To(Succeed())
+		Expect(New(redisClient, testRedisKey, &Options{OwnerID: "worker-1", Codec: JSONCodec}).Lock()).To(BeTrue())
+		_, err := inner.Lock()
+		Expect(err).To(Equal(ErrLockLost))
+
+		Expect(New(redisClient, testRedisKey, &Options{OwnerID: "worker-2", Reentrant: true, Codec: JSONCodec}).Lock()).To(BeFalse())
+
+		otherKey := testRedisKey + ":other"
+		defer redisClient.Del(otherKey, holderKey("worker-1"))
+		Expect(New(redisClient, otherKey, &Options{OwnerID: "worker-1", TrackOwner: true}).Lock()).To(BeTrue())
+		Expect(HeldBy(redisClient, "worker-1")).To(ConsistOf(otherKey))
+	})
+
+	It("should hand off synchronously", func() {
+		holder := New(redisClient, testRedisKey, &Options{SyncHandoff: time.Second})
+		Expect(holder.Lock()).To(BeTrue())
+
+		waiter := New(redisClient, testRedisKey, &Options{SyncHandoff: time.Second, WaitTimeout: 5 * time.Second, WaitRetry: time.Second, DebugTrace: 1})
+		done := make(chan bool, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			ok, err := waiter.Lock()
+			Expect(err).NotTo(HaveOccurred())
+			done <- ok
+		}()
+		Eventually(waiter.DebugTrace).Should(HaveLen(1))
+
+		start := time.Now()
+		Expect(holder.Unlock()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(1)))
+		Expect(<-done).To(BeTrue())
+
+		start = time.Now()
+		Expect(waiter.Unlock()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+	It("should limit attempts fleet-wide", func() {
+		defer redisClient.Del(attemptsKey(testRedisKey))
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+
+		opts := &Options{AttemptLimit: 3, AttemptWindow: 200 * time.Millisecond}
+		for i := 0; i < 3; i++ {
+			Expect(New(redisClient, testRedisKey, opts).Lock()).To(BeFalse())
+		}
+		_, err := New(redisClient, testRedisKey, opts).Lock()
+		Expect(err).To(Equal(ErrTooManyWaiters))
+
+		Eventually(func() error {
+			_, err := New(redisClient, testRedisKey, opts).Lock()
+			return err
+		}).Should(Succeed())
+	})
+
+	It("should cancel lock groups on loss", func() {
+		lock := New(redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond, StrictOwnership: true})
+		Expect(lock.Lock()).To(BeTrue())
+
+		group := lock.Group(context.Background())
+		group.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+
+		time.Sleep(150 * time.Millisecond)
+		Expect(group.Context().Err()).NotTo(HaveOccurred())
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(group.Wait()).To(Equal(ErrLockLost))
+
+		Expect(lock.Lock()).To(BeTrue())
+		failing := errors.New("failed")
+		group = lock.Group(context.Background())
+		group.Go(func(ctx context.Context) error { return failing })
+		group.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		Expect(group.Wait()).To(Equal(failing))
+		Expect(lock.IsLocked()).To(BeTrue())
+	})
+
+	It("should cancel lock groups when refreshes keep failing", func() {
+		boom := errors.New("boom")
+		lock := New(redisClient, testRedisKey, &Options{LockTimeout: 100 * time.Millisecond, Failpoint: FailAt(BeforeRefresh, boom)})
+		Expect(lock.Lock()).To(BeTrue())
+
+		start := time.Now()
+		group := lock.Group(context.Background())
+		group.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+
+		err := group.Wait()
+		Expect(errors.Is(err, ErrLockLost)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("boom")))
+		Expect(time.Since(start)).To(BeNumerically("<", 150*time.Millisecond))
+	})
+
+	It("should accept legacy values during upgrades", func() {
+		defer redisClient.Del(testRedisKey + ":list")
+
+		old, err := ObtainLock(redisClient, testRedisKey, &Options{Codec: PlainCodec})
+		Expect(err).NotTo(HaveOccurred())
+		token := redisClient.Get(testRedisKey).Val()
+		Expect(token).To(Equal(old.token))
+
+		_, err = Adopt(redisClient, testRedisKey, token, &Options{Codec: JSONCodec})
+		Expect(err).To(Equal(ErrLockLost))
+
+		lock, err := Adopt(redisClient, testRedisKey, token, &Options{Codec: JSONCodec, AcceptLegacyValues: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(redisClient.Get(testRedisKey).Val()).To(Equal(token))
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 5*time.Second, 100*time.Millisecond))
+		Expect(lock.ExtendIfExpiringWithin(time.Minute, 10*time.Second)).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 10*time.Second, 100*time.Millisecond))
+
+		Expect(redisClient.RPush(testRedisKey+":list", "a").Err()).NotTo(HaveOccurred())
+		item, ok, err := NewLockedQueue(lock, testRedisKey+":list").Pop()
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ok).To(BeTrue())
-		Expect(subject.IsLocked()).To(BeTrue())
+		Expect(item).To(Equal("a"))
 
-		val := redisClient.Get(testRedisKey).Val()
-		Expect(val).To(HaveLen(24))
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
 
-		ttl := redisClient.PTTL(testRedisKey).Val()
-		Expect(ttl).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+		Expect(redisClient.Set(testRedisKey, token, time.Minute).Err()).NotTo(HaveOccurred())
+		lock, err = Adopt(redisClient, testRedisKey, token, &Options{Codec: JSONCodec, AcceptLegacyValues: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock.Verify()).To(BeTrue())
+		Expect(lock.IsLockedFresh(0)).To(BeTrue())
+		Expect(lock.Drain(100 * time.Millisecond)).To(Succeed())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 100*time.Millisecond, 10*time.Millisecond))
+
+		pipe := redisClient.Pipeline()
+		defer pipe.Close()
+
+		pending := lock.UnlockPipelined(pipe)
+		_, err = pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending.Result()).To(BeTrue())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
 	})
 
-	It("should wait for expiring locks if WaitTimeout is set", func() {
+	It("should verify quorums", func() {
+		other := redis.NewClient(&redis.Options{Network: "tcp", Addr: "127.0.0.1:6379", DB: 8})
+		defer other.Close()
+
+		lock := New(redisClient, testRedisKey, nil)
+		Expect(lock.Lock()).To(BeTrue())
+		defer lock.Unlock()
+
+		ctx := context.Background()
+		Expect(lock.VerifyQuorum(ctx, []*redis.Client{redisClient, other, redisClient})).To(BeTrue())
+		Expect(lock.VerifyQuorum(ctx, []*redis.Client{other, other, redisClient})).To(BeFalse())
+
+		budget := NewBudget(0)
+		_, err := lock.VerifyQuorum(ContextWithBudget(ctx, budget), []*redis.Client{redisClient})
+		Expect(err).To(Equal(ErrQuorumTimeout))
+	})
+
+	It("should post webhooks", func() {
+		events := make(chan WebhookEvent, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get(WebhookSignatureHeader) != SignWebhook([]byte("secret"), body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var event WebhookEvent
+			Expect(json.Unmarshal(body, &event)).To(Succeed())
+			events <- event
+		}))
+		defer server.Close()
+
+		lock := New(redisClient, testRedisKey, &Options{Webhook: &Webhook{URL: server.URL, Secret: []byte("secret")}})
+		next := func() string {
+			var event WebhookEvent
+			Eventually(events).Should(Receive(&event))
+			Expect(event.Key).To(Equal(testRedisKey))
+			return event.Event
+		}
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(next()).To(Equal(WebhookAcquired))
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(next()).To(Equal(WebhookReleased))
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(next()).To(Equal(WebhookAcquired))
 		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
-		Expect(redisClient.PExpire(testRedisKey, 50*time.Millisecond).Err()).NotTo(HaveOccurred())
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(next()).To(Equal(WebhookStolen))
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
 
-		ok, err := subject.Lock()
-		Expect(err).NotTo(HaveOccurred())
-		Expect(ok).To(BeTrue())
-		Expect(subject.IsLocked()).To(BeTrue())
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(next()).To(Equal(WebhookAcquired))
+		Expect(redisClient.Del(testRedisKey).Err()).NotTo(HaveOccurred())
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(next()).To(Equal(WebhookExpired))
+	})
 
-		val := redisClient.Get(testRedisKey).Val()
-		Expect(val).To(HaveLen(24))
-		Expect(subject.token).To(Equal(val))
+	It("should rotate locks among participants", func() {
+		defer redisClient.Del(testRedisKey+":participants", testRedisKey+":turn")
 
-		ttl := redisClient.PTTL(testRedisKey).Val()
-		Expect(ttl).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+		participants := make(map[string]*Locker)
+		for _, id := range []string{"a", "b", "c"} {
+			participants[id] = New(redisClient, testRedisKey, &Options{Rotation: id})
+		}
+		turn := func() string {
+			var holders []string
+			for _, id := range []string{"c", "b", "a"} {
+				if ok, err := participants[id].Lock(); err == nil && ok {
+					holders = append(holders, id)
+				}
+			}
+			Expect(holders).To(HaveLen(1))
+			return holders[0]
+		}
+
+		Expect(turn()).To(Equal("c"))
+		Expect(participants["c"].Unlock()).To(Succeed())
+		Expect(turn()).To(Equal("a"))
+		Expect(participants["a"].Unlock()).To(Succeed())
+		Expect(turn()).To(Equal("b"))
+		Expect(participants["b"].Unlock()).To(Succeed())
+		Expect(turn()).To(Equal("c"))
+		Expect(participants["c"].Unlock()).To(Succeed())
+
+		Expect(participants["a"].LeaveRotation()).To(Succeed())
+		Expect(participants["b"].Lock()).To(BeTrue())
 	})
 
-	It("should wait until WaitTimeout is reached, then give up", func() {
+	It("should read and write payloads with the lock", func() {
+		defer redisClient.Del(testRedisKey + ":payload")
+
+		lock := New(redisClient, testRedisKey, nil)
+		payload, ok, err := lock.GetAndLock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(payload).To(BeEmpty())
+		Expect(lock.UnlockWith("42")).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		payload, ok, err = lock.GetAndLock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(payload).To(Equal("42"))
+
 		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
-		Expect(redisClient.PExpire(testRedisKey, 150*time.Millisecond).Err()).NotTo(HaveOccurred())
+		Expect(lock.UnlockWith("43")).To(Equal(ErrLockLost))
+		Expect(redisClient.Get(testRedisKey + ":payload").Val()).To(Equal("42"))
 
-		ok, err := subject.Lock()
+		_, ok, err = lock.GetAndLock()
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ok).To(BeFalse())
-		Expect(subject.IsLocked()).To(BeFalse())
-		Expect(subject.token).To(Equal(""))
+	})
 
-		val := redisClient.Get(testRedisKey).Val()
-		Expect(val).To(Equal("ABCD"))
+	It("should warm up", func() {
+		Expect(redisClient.ScriptFlush().Err()).NotTo(HaveOccurred())
+		client := redis.NewClient(redisClient.Options())
+		defer client.Close()
 
-		ttl := redisClient.PTTL(testRedisKey).Val()
-		Expect(ttl).To(BeNumerically("~", 50*time.Millisecond, 10*time.Millisecond))
+		lock := New(client, testRedisKey, nil)
+		Expect(lock.Warmup(context.Background())).To(Succeed())
+		Expect(client.PoolStats().TotalConns).To(Equal(uint32(1)))
+		Expect(client.ScriptExists(scriptSHA(luaRefresh)).Val()).To(Equal([]bool{true}))
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.Unlock()).To(Succeed())
 	})
 
-	It("should not wait for expiring locks if WaitTimeout is not set", func() {
+	It("should survive wall clock steps", func() {
+		var offset time.Duration
+		defer func(orig func() time.Time) { wallNow = orig }(wallNow)
+		wallNow = func() time.Time { return time.Now().Round(0).Add(offset) }
+
+		var steps []time.Duration
+		lock := New(redisClient, testRedisKey, &Options{OnClockStep: func(step time.Duration) { steps = append(steps, step) }})
+		Expect(lock.Lock()).To(BeTrue())
+
+		offset = -time.Hour
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.ProbablyHeld()).To(BeTrue())
+		Expect(steps).To(HaveLen(1))
+		Expect(steps[0]).To(BeNumerically("~", -time.Hour, time.Second))
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(steps).To(HaveLen(1))
+		Expect(lock.Unlock()).To(Succeed())
+	})
+
+	It("should cache fresh lock state", func() {
+		lock := New(redisClient, testRedisKey, nil)
+		Expect(lock.IsLockedFresh(time.Second)).To(BeFalse())
+		Expect(lock.Lock()).To(BeTrue())
+		defer lock.Unlock()
+
 		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
-		Expect(redisClient.PExpire(testRedisKey, 150*time.Millisecond).Err()).NotTo(HaveOccurred())
-		subject.opts.WaitTimeout = 0
+		Expect(lock.IsLockedFresh(time.Second)).To(BeTrue())
+		Expect(lock.IsLockedFresh(0)).To(BeFalse())
+	})
 
-		ok, err := subject.Lock()
+	It("should panic on misuse in strict mode", func() {
+		lock := New(redisClient, testRedisKey, &Options{StrictMode: true})
+		Expect(func() { _ = lock.Unlock() }).To(PanicWith(&MisuseError{Key: testRedisKey, Op: "Unlock", Reason: "not locked"}))
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.Unlock()).To(Succeed())
+		Expect(func() { _, _ = lock.ExtendIfExpiringWithin(time.Second, time.Second) }).To(PanicWith(MatchError("lock: misuse of " + testRedisKey + " in ExtendIfExpiringWithin: already released")))
+
+		Expect(New(redisClient, testRedisKey, nil).Unlock()).To(Succeed())
+
+		if goroutineID() == 0 {
+			return
+		}
+		Expect(lock.Lock()).To(BeTrue())
+		done := make(chan interface{})
+		go func() {
+			defer func() { done <- recover() }()
+			_ = lock.Unlock()
+		}()
+		Expect(<-done).To(BeAssignableToTypeOf(&MisuseError{}))
+		Expect(lock.Unlock()).To(Succeed())
+	})
+
+	It("should bound the execution time of handlers", func() {
+		opts := &Options{LockTimeout: 50 * time.Millisecond, ExecutionTimeout: 200 * time.Millisecond}
+		Expect(RunWithLockContext(context.Background(), redisClient, testRedisKey, opts, func(ctx context.Context) error {
+			time.Sleep(100 * time.Millisecond)
+			Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(1)))
+			return nil
+		})).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		err := RunWithLockContext(context.Background(), redisClient, testRedisKey, opts, func(ctx context.Context) error {
+			<-ctx.Done()
+			Eventually(func() int64 { return redisClient.Exists(testRedisKey).Val() }).Should(Equal(int64(0)))
+			return ctx.Err()
+		})
+		Expect(err).To(Equal(ErrExecutionTimeout))
+
+		Expect(RunWithLock(redisClient, testRedisKey, opts, func() error {
+			time.Sleep(250 * time.Millisecond)
+			return nil
+		})).To(Equal(ErrExecutionTimeout))
+	})
+
+	It("should chain locksmith middlewares", func() {
+		var ops, logged []string
+		boom := errors.New("boom")
+		smith := Chain(NewLocksmith(redisClient, nil),
+			Instrument(func(op, key string, _ time.Duration, err error) { ops = append(ops, op) }),
+			Log(func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }),
+			MaxConcurrent(1),
+		)
+		Expect(smith.Run(testRedisKey, nil, func() error { return nil })).To(Succeed())
+		Expect(smith.Status(testRedisKey)).To(Equal(&Status{}))
+		Expect(ops).To(Equal([]string{"run", "status"}))
+		Expect(logged).To(BeEmpty())
+
+		smith = Chain(smith, Chaos(1, boom))
+		_, err := smith.Obtain(testRedisKey, nil)
+		Expect(err).To(Equal(boom))
+		Expect(ops).To(HaveLen(2))
+
+		smith = Chain(NewLocksmith(redisClient, nil), Log(func(format string, args ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}), Chaos(1, boom))
+		Expect(smith.Run(testRedisKey, nil, func() error { return nil })).To(Equal(boom))
+		Expect(logged).To(Equal([]string{`lock: run "` + testRedisKey + `" failed: boom`}))
+	})
+
+	It("should define named locks", func() {
+		registry := NewRegistry(redisClient)
+		Expect(registry.Load(strings.NewReader(`{"locks":{"reports":{"lock_timeout":"30s","refresh_mode":"extend"}}}`))).To(Succeed())
+		registry.Define("jobs", &Options{LockTimeout: time.Second})
+
+		locker, err := registry.Obtain("reports", testRedisKey)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(ok).To(BeFalse())
-		Expect(subject.IsLocked()).To(BeFalse())
+		Expect(locker.Options().LockTimeout).To(Equal(30 * time.Second))
+		Expect(locker.Options().RefreshMode).To(Equal(ExtendBy))
+		Expect(locker.Unlock()).To(Succeed())
 
-		ttl := redisClient.PTTL(testRedisKey).Val()
-		Expect(ttl).To(BeNumerically("~", 150*time.Millisecond, 10*time.Millisecond))
+		Expect(registry.Run("jobs", testRedisKey, func() error {
+			Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+			return nil
+		})).To(Succeed())
+
+		registry.Define("bounded", &Options{ExecutionTimeout: 20 * time.Millisecond})
+		Expect(registry.Run("bounded", testRedisKey, func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})).To(Equal(ErrExecutionTimeout))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		_, err = registry.For("unknown", testRedisKey)
+		Expect(errors.Is(err, ErrUnknownLock)).To(BeTrue())
+		Expect(registry.Load(strings.NewReader(`{"locks":{"reports":{"lock_timeout":"soon"}}}`))).NotTo(Succeed())
+		Expect(registry.Load(strings.NewReader(`{"locks":{"reports":{"timeout":"1s"}}}`))).NotTo(Succeed())
+	})
+
+	It("should release locks of stalled holders", func() {
+		lock := New(redisClient, testRedisKey, &Options{DeadmanInterval: 100 * time.Millisecond})
+		Expect(lock.Lock()).To(BeTrue())
+
+		time.Sleep(60 * time.Millisecond)
+		lock.Progress()
+		time.Sleep(60 * time.Millisecond)
+		Expect(lock.Lock()).To(BeTrue())
+
+		time.Sleep(120 * time.Millisecond)
+		_, err := lock.Lock()
+		Expect(err).To(Equal(ErrDeadman))
+		Expect(lock.IsLocked()).To(BeFalse())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		Expect(lock.Lock()).To(BeTrue())
+		Expect(lock.Unlock()).To(Succeed())
+	})
+
+	It("should run each key with lock", func() {
+		keys := []string{testRedisKey + ":a", testRedisKey + ":b", testRedisKey + ":c"}
+		defer redisClient.Del(keys...)
+		Expect(New(redisClient, keys[1], nil).Lock()).To(BeTrue())
+
+		var ran int32
+		err := RunEachWithLock(context.Background(), redisClient, keys, nil, 2, func(_ context.Context, key string) error {
+			atomic.AddInt32(&ran, 1)
+			if key == keys[2] {
+				return io.EOF
+			}
+			return nil
+		})
+		Expect(atomic.LoadInt32(&ran)).To(Equal(int32(2)))
+
+		var batch *BatchError
+		Expect(errors.As(err, &batch)).To(BeTrue())
+		Expect(batch.Errors).To(HaveLen(2))
+		Expect(batch.Errors[keys[1]]).To(MatchError(ErrCannotGetLock))
+		Expect(batch.Errors[keys[2]]).To(Equal(io.EOF))
+		Expect(errors.Is(err, io.EOF)).To(BeTrue())
+		Expect(errors.Is(err, ErrCannotGetLock)).To(BeTrue())
+		Expect(errors.Is(err, ErrLockLost)).To(BeFalse())
+
+		var lockErr *LockError
+		Expect(errors.As(err, &lockErr)).To(BeTrue())
+		Expect(lockErr.Key).To(Equal(keys[1]))
+	})
+
+	It("should count the Redis load of acquisitions", func() {
+		before := ReadStats()
+		locker := New(redisClient, testRedisKey, nil)
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.AcquisitionCost()).To(Equal(AcquisitionCost{Attempts: 1, Commands: 1}))
+
+		waiter := New(redisClient, testRedisKey, &Options{WaitTimeout: 100 * time.Millisecond, WaitRetry: 20 * time.Millisecond})
+		Expect(waiter.Lock()).To(BeFalse())
+		cost := waiter.AcquisitionCost()
+		Expect(cost.Attempts).To(BeNumerically(">", 1))
+		Expect(cost.Commands).To(BeNumerically(">", cost.Attempts))
+		Expect(cost.Scripts).To(BeNumerically(">", 0))
+
+		after := ReadStats()
+		Expect(after.Acquisitions - before.Acquisitions).To(BeNumerically(">=", 2))
+		Expect(after.AcquisitionAttempts - before.AcquisitionAttempts).To(BeNumerically(">=", int64(cost.Attempts+1)))
+	})
+
+	It("should read the holder TTL once per attempt", func() {
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+
+		var pttls int
+		client := redis.NewClient(redisClient.Options())
+		defer client.Close()
+		client.WrapProcess(func(old func(redis.Cmder) error) func(redis.Cmder) error {
+			return func(cmd redis.Cmder) error {
+				if cmd.Name() == "pttl" {
+					pttls++
+				}
+				return old(cmd)
+			}
+		})
+
+		locker := New(client, testRedisKey, &Options{Datacenter: "b", PreferredDatacenter: "a", DebugTrace: 1})
+		Expect(locker.Lock()).To(BeFalse())
+		Expect(locker.RetryAfter()).To(BeNumerically(">", 0))
+		Expect(pttls).To(Equal(1))
+	})
+
+	It("should adopt locks by token", func() {
+		Expect(New(redisClient, testRedisKey, &Options{LockTimeout: time.Second}).Lock()).To(BeTrue())
+		holder, err := Holder(redisClient, testRedisKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Adopt(redisClient, testRedisKey, "other", nil)
+		Expect(err).To(Equal(ErrLockLost))
+
+		adopted, err := Adopt(redisClient, testRedisKey, holder.Token, &Options{LockTimeout: time.Minute})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adopted.IsLocked()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically(">", time.Second))
+		Expect(adopted.Unlock()).To(Succeed())
+		Expect(redisClient.Exists(testRedisKey).Val()).To(BeZero())
+	})
+
+	It("should execute shared calls once and share results", func() {
+		defer redisClient.Del(testRedisKey + ":result")
+
+		var (
+			wg    sync.WaitGroup
+			execs int32
+		)
+
+		results := make([][]byte, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				res, err := SharedDo(context.Background(), redisClient, testRedisKey, time.Second, func() ([]byte, error) {
+					atomic.AddInt32(&execs, 1)
+					time.Sleep(50 * time.Millisecond)
+					return []byte("result"), nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				results[i] = res
+			}(i)
+		}
+		wg.Wait()
+
+		Expect(execs).To(Equal(int32(1)))
+		for _, res := range results {
+			Expect(string(res)).To(Equal("result"))
+		}
+		Expect(redisClient.PTTL(testRedisKey + ":result").Val()).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+	})
+
+	It("should stop waiting for shared calls when the context is done", func() {
+		Expect(New(redisClient, testRedisKey, nil).Lock()).To(BeTrue())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := SharedDo(ctx, redisClient, testRedisKey, time.Second, func() ([]byte, error) {
+			return []byte("result"), nil
+		})
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
 	})
 
 	It("should release own locks", func() {
@@ -161,6 +2282,36 @@ var _ = Describe("Locker", func() {
 		Expect(ttl).To(BeNumerically("~", time.Second, 10*time.Millisecond))
 	})
 
+	It("should support refresh modes", func() {
+		locker := New(redisClient, testRedisKey, &Options{LockTimeout: time.Second, RefreshMode: ExtendBy})
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 2*time.Second, 10*time.Millisecond))
+
+		locker.opts.RefreshMode = KeepTTL
+		time.Sleep(50 * time.Millisecond)
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 1950*time.Millisecond, 10*time.Millisecond))
+
+		locker.opts.RefreshMode = ResetTTL
+		Expect(locker.Lock()).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+	})
+
+	It("should extend locks only when expiring", func() {
+		Expect(subject.Lock()).To(BeTrue())
+
+		Expect(subject.ExtendIfExpiringWithin(500*time.Millisecond, 2*time.Second)).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", time.Second, 10*time.Millisecond))
+
+		Expect(subject.ExtendIfExpiringWithin(time.Second, 2*time.Second)).To(BeTrue())
+		Expect(redisClient.PTTL(testRedisKey).Val()).To(BeNumerically("~", 2*time.Second, 10*time.Millisecond))
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(subject.ExtendIfExpiringWithin(time.Second, 2*time.Second)).To(BeFalse())
+		Expect(subject.IsLocked()).To(BeFalse())
+	})
+
 	It("should re-create expired locks on refresh", func() {
 		ok, err := subject.Lock()
 		Expect(err).NotTo(HaveOccurred())
@@ -252,6 +2403,39 @@ var _ = Describe("Locker", func() {
 		Expect(res).To(Equal(int32(0)))
 	})
 
+	It("should run with locks and return results", func() {
+		res, err := Run(redisClient, testRedisKey, nil, func() (string, error) {
+			Expect(redisClient.Get(testRedisKey).Val()).To(HaveLen(24))
+			return "done", nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal("done"))
+		Expect(redisClient.Exists(testRedisKey).Val()).To(Equal(int64(0)))
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		_, err = Run(redisClient, testRedisKey, nil, func() (int, error) {
+			return 1, nil
+		})
+		Expect(err).To(MatchError(ErrCannotGetLock))
+	})
+
+	It("should adapt to sync.Locker", func() {
+		mu := subject.SyncLocker(false)
+		mu.Lock()
+		Expect(subject.IsLocked()).To(BeTrue())
+		mu.Unlock()
+		Expect(subject.IsLocked()).To(BeFalse())
+
+		Expect(redisClient.Set(testRedisKey, "ABCD", 0).Err()).NotTo(HaveOccurred())
+		Expect(mu.Lock).To(Panic())
+
+		Expect(redisClient.PExpire(testRedisKey, 50*time.Millisecond).Err()).NotTo(HaveOccurred())
+		mu = subject.SyncLocker(true)
+		mu.Lock()
+		Expect(subject.IsLocked()).To(BeTrue())
+		mu.Unlock()
+	})
+
 	It("should wait for locks", func() {
 		var (
 			wg  sync.WaitGroup
@@ -320,6 +2504,59 @@ func TestSuite(t *testing.T) {
 
 var redisClient *redis.Client
 
+type flakyClient struct {
+	*redis.Client
+	failures int
+	err      error
+}
+
+func (c *flakyClient) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if err := c.fail(); err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	return c.Client.SetNX(key, value, expiration)
+}
+
+// Eval fails retried acquisitions, like SetNX
+func (c *flakyClient) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == luaObtainOrYield {
+		if err := c.fail(); err != nil {
+			return redis.NewCmdResult(nil, err)
+		}
+	}
+	return c.Client.Eval(script, keys, args...)
+}
+
+func (c *flakyClient) EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	if sha1 == scriptSHA(luaObtainOrYield) {
+		if err := c.fail(); err != nil {
+			return redis.NewCmdResult(nil, err)
+		}
+	}
+	return c.Client.EvalSha(sha1, keys, args...)
+}
+
+func (c *flakyClient) fail() error {
+	if c.failures <= 0 {
+		return nil
+	}
+	c.failures--
+	if c.err != nil {
+		return c.err
+	}
+	return errors.New("LOADING Redis is loading the dataset in memory")
+}
+
+type skewedClient struct {
+	*redis.Client
+	offset time.Duration
+}
+
+func (c *skewedClient) PTTL(key string) *redis.DurationCmd {
+	ttl := c.Client.PTTL(key).Val()
+	return redis.NewDurationResult(ttl+c.offset, nil)
+}
+
 var _ = BeforeSuite(func() {
 	redisClient = redis.NewClient(&redis.Options{
 		Network: "tcp",
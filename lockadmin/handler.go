@@ -0,0 +1,129 @@
+// Package lockadmin provides an HTTP handler which reports the current
+// locks as JSON, to be mounted under an internal admin mux, e.g.
+//
+//	mux.Handle("/admin/locks", lockadmin.Handler(client, "locks:"))
+package lockadmin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+)
+
+// companionSuffixes are the suffixes of keys which accompany lock keys
+var companionSuffixes = []string{
+	":attempts", ":audit", ":heartbeat", ":intents", ":participants", ":payload", ":queue", ":result", ":schedule",
+	":successors", ":turn",
+}
+
+type scanner interface {
+	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// Report is the JSON response of Handler
+type Report struct {
+	Prefix    string    `json:"prefix"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Locks     []Lock    `json:"locks"`
+}
+
+// Lock describes a held lock. Tokens are never exposed.
+type Lock struct {
+	Key         string            `json:"key"`
+	TTL         int64             `json:"ttl_ms"` // -1 if no expiry is set
+	Holder      map[string]string `json:"holder,omitempty"`
+	QueueLength int               `json:"queue_length"`
+}
+
+// Handler returns a handler which SCANs all keys matching prefix and
+// responds with a Report of the locks currently held. Holder metadata is
+// decoded from values written by JSONCodec and VersionedCodec.
+func Handler(client lock.RedisClient, prefix string) http.Handler {
+	smith := lock.NewLocksmith(client, &lock.Options{Codec: anyCodec{}})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := scan(client, smith, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+func scan(client lock.RedisClient, smith lock.Locksmith, prefix string) (*Report, error) {
+	sc, ok := client.(scanner)
+	if !ok {
+		return nil, lock.ErrScanUnsupported
+	}
+
+	report := &Report{Prefix: prefix, ScannedAt: time.Now(), Locks: []Lock{}}
+	var cursor uint64
+	for {
+		keys, next, err := sc.Scan(cursor, prefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if isCompanion(key) {
+				continue
+			}
+
+			// Scripts report WRONGTYPE with a prefix before Redis 7
+			status, err := smith.Status(key)
+			if err != nil && strings.Contains(err.Error(), "WRONGTYPE") {
+				continue
+			} else if err != nil {
+				return nil, err
+			} else if !status.Locked {
+				continue
+			}
+
+			queued, err := lock.QueueLength(client, key)
+			if err != nil {
+				return nil, err
+			}
+
+			info := Lock{Key: key, TTL: -1, Holder: status.Holder.Metadata, QueueLength: queued}
+			if status.TTL >= 0 {
+				info.TTL = int64(status.TTL / time.Millisecond)
+			}
+			report.Locks = append(report.Locks, info)
+		}
+
+		if cursor = next; cursor == 0 {
+			return report, nil
+		}
+	}
+}
+
+func isCompanion(key string) bool {
+	for _, suffix := range companionSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyCodec decodes JSON values and falls back to VersionedCodec,
+// which also accepts plain tokens
+type anyCodec struct{}
+
+func (anyCodec) Encode(v lock.Value) (string, error) { return lock.VersionedCodec.Encode(v) }
+
+func (anyCodec) Decode(s string) (lock.Value, error) {
+	if strings.HasPrefix(s, "{") {
+		if v, err := lock.JSONCodec.Decode(s); err == nil {
+			return v, nil
+		}
+	}
+	return lock.VersionedCodec.Decode(s)
+}
@@ -0,0 +1,93 @@
+package lockadmin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const testPrefix = "__bsm_redis_lock_lockadmin_unit_test__:"
+
+var _ = Describe("Handler", func() {
+	get := func() *Report {
+		rec := httptest.NewRecorder()
+		Handler(redisClient, testPrefix).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/locks", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		report := new(Report)
+		Expect(json.NewDecoder(rec.Body).Decode(report)).To(Succeed())
+		return report
+	}
+
+	It("should report empty prefixes", func() {
+		report := get()
+		Expect(report.Prefix).To(Equal(testPrefix))
+		Expect(report.ScannedAt).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(report.Locks).To(BeEmpty())
+	})
+
+	It("should report held locks", func() {
+		held := lock.New(redisClient, testPrefix+"held", &lock.Options{
+			LockTimeout: 10 * time.Second,
+			Codec:       lock.JSONCodec,
+			Metadata:    map[string]string{"host": "a"},
+			Heartbeat:   true,
+		})
+		Expect(held.Lock()).To(BeTrue())
+		Expect(redisClient.ZAdd(testPrefix+"held:queue", redis.Z{Score: 1, Member: "w1"}, redis.Z{Score: 2, Member: "w2"}).Err()).To(Succeed())
+
+		Expect(redisClient.Set(testPrefix+"persistent", "token", 0).Err()).To(Succeed())
+		Expect(redisClient.HSet(testPrefix+"hash", "field", "value").Err()).To(Succeed())
+
+		report := get()
+		Expect(report.Locks).To(HaveLen(2))
+
+		locks := make(map[string]Lock, len(report.Locks))
+		for _, l := range report.Locks {
+			locks[l.Key] = l
+		}
+		Expect(locks).To(HaveKey(testPrefix + "held"))
+		Expect(locks[testPrefix+"held"].TTL).To(BeNumerically("~", 10000, 100))
+		Expect(locks[testPrefix+"held"].Holder).To(HaveKeyWithValue("host", "a"))
+		Expect(locks[testPrefix+"held"].QueueLength).To(Equal(2))
+
+		Expect(locks).To(HaveKey(testPrefix + "persistent"))
+		Expect(locks[testPrefix+"persistent"].TTL).To(Equal(int64(-1)))
+		Expect(locks[testPrefix+"persistent"].Holder).To(BeEmpty())
+		Expect(locks[testPrefix+"persistent"].QueueLength).To(BeZero())
+	})
+})
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	AfterEach(func() {
+		keys, err := redisClient.Keys(testPrefix + "*").Result()
+		Expect(err).NotTo(HaveOccurred())
+		if len(keys) != 0 {
+			Expect(redisClient.Del(keys...).Err()).NotTo(HaveOccurred())
+		}
+	})
+	RunSpecs(t, "redis-lock/lockadmin")
+}
+
+var redisClient *redis.Client
+
+var _ = BeforeSuite(func() {
+	redisClient = redis.NewClient(&redis.Options{
+		Network: "tcp",
+		Addr:    "127.0.0.1:6379", DB: 9,
+	})
+	Expect(redisClient.Ping().Err()).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	redisClient.Close()
+})
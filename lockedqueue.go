@@ -0,0 +1,51 @@
+package lock
+
+const luaLockedPop = `local v = redis.call("get", KEYS[1])
+if v ~= ARGV[1] and v ~= ARGV[2] then return {0} end
+local item = redis.call("lpop", KEYS[2])
+if not item then return {1} end
+return {1, item}`
+
+// LockedQueue is a Redis list which is consumed by the holder of a lock
+// only, guaranteeing a single consumer. Producers push items to the tail
+// (RPUSH) as usual. With sharded clients, the list and the lock key must
+// share a hash tag.
+type LockedQueue struct {
+	locker *Locker
+	list   string
+}
+
+// NewLockedQueue returns a queue for list, gated by locker
+func NewLockedQueue(locker *Locker, list string) *LockedQueue {
+	return &LockedQueue{locker: locker, list: list}
+}
+
+// Pop removes and returns the item at the head of the list, if the lock is
+// held. It returns false if the list is empty, ErrNotLocked if the lock was
+// not obtained and ErrLockLost if it was taken over in the meantime.
+func (q *LockedQueue) Pop() (string, bool, error) {
+	l := q.locker
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" {
+		return "", false, ErrNotLocked
+	}
+
+	res, err := eval(l.client, luaLockedPop, []string{l.key, q.list}, append([]interface{}{l.value}, l.legacyValue()...)...).Result()
+	if err != nil {
+		return "", false, err
+	}
+
+	vals, _ := res.([]interface{})
+	if len(vals) == 0 || vals[0] != int64(1) {
+		l.setState(Lost)
+		l.reset()
+		return "", false, ErrLockLost
+	} else if len(vals) == 1 {
+		return "", false, nil
+	}
+
+	item, _ := vals[1].(string)
+	return item, true, nil
+}
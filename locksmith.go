@@ -0,0 +1,96 @@
+package lock
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const luaStatus = `local v = redis.call("get", KEYS[1]) if not v then return false end return {v, redis.call("pttl", KEYS[1])}`
+
+var errUnexpectedReply = errors.New("unexpected reply")
+
+// Locksmith is the interface of the package-level API. Applications may
+// depend on it and use locktest.Locksmith in unit tests.
+type Locksmith interface {
+	// Obtain is the equivalent of ObtainLock
+	Obtain(key string, opts *Options) (*Locker, error)
+	// Run is the equivalent of RunWithLock
+	Run(key string, opts *Options, handler func() error) error
+	// Status reports the current state of a lock key
+	Status(key string) (*Status, error)
+}
+
+// Status describes the current state of a lock key
+type Status struct {
+	// Locked is true if the key is currently locked
+	Locked bool
+
+	// TTL is the remaining lock time, negative if no expiry is set
+	TTL time.Duration
+
+	// Holder is the decoded value of the current holder
+	Holder *Value
+}
+
+type locksmith struct {
+	client RedisClient
+	opts   *Options
+}
+
+// NewLocksmith returns a Locksmith backed by client. The given opts
+// are used as defaults when nil options are passed to Obtain or Run.
+func NewLocksmith(client RedisClient, opts *Options) Locksmith {
+	return &locksmith{client: client, opts: opts}
+}
+
+func (s *locksmith) Obtain(key string, opts *Options) (*Locker, error) {
+	return ObtainLock(s.client, key, s.options(opts))
+}
+
+func (s *locksmith) Run(key string, opts *Options, handler func() error) error {
+	return RunWithLock(s.client, key, s.options(opts), handler)
+}
+
+func (s *locksmith) Status(key string) (*Status, error) {
+	res, err := eval(s.client, luaStatus, []string{key}).Result()
+	if err == redis.Nil {
+		return &Status{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pair, _ := res.([]interface{})
+	if len(pair) != 2 {
+		return nil, errUnexpectedReply
+	}
+	raw, _ := pair[0].(string)
+	ttl, _ := pair[1].(int64)
+
+	opts := s.options(nil)
+	if opts == nil {
+		opts = new(Options)
+	}
+	holder, err := opts.normalize().Codec.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Locked: true, TTL: time.Duration(ttl) * time.Millisecond, Holder: &holder}
+	if ttl < 0 {
+		status.TTL = -1
+	}
+	return status, nil
+}
+
+func (s *locksmith) options(opts *Options) *Options {
+	if opts != nil {
+		return opts
+	}
+	if s.opts == nil {
+		return nil
+	}
+	o := *s.opts
+	return &o
+}
@@ -0,0 +1,42 @@
+// Package locktest provides helpers for testing code which uses redis-lock.
+// The helpers in this package only depend on the standard testing package.
+package locktest
+
+import (
+	lock "github.com/bsm/redis-lock"
+)
+
+// Locksmith is a mock lock.Locksmith. Each method delegates to the
+// corresponding func field, if set. Otherwise, Obtain and Status
+// return zero values and Run calls the handler directly.
+type Locksmith struct {
+	ObtainFunc func(key string, opts *lock.Options) (*lock.Locker, error)
+	RunFunc    func(key string, opts *lock.Options, handler func() error) error
+	StatusFunc func(key string) (*lock.Status, error)
+}
+
+var _ lock.Locksmith = (*Locksmith)(nil)
+
+// Obtain implements lock.Locksmith
+func (m *Locksmith) Obtain(key string, opts *lock.Options) (*lock.Locker, error) {
+	if m.ObtainFunc != nil {
+		return m.ObtainFunc(key, opts)
+	}
+	return nil, nil
+}
+
+// Run implements lock.Locksmith
+func (m *Locksmith) Run(key string, opts *lock.Options, handler func() error) error {
+	if m.RunFunc != nil {
+		return m.RunFunc(key, opts, handler)
+	}
+	return handler()
+}
+
+// Status implements lock.Locksmith
+func (m *Locksmith) Status(key string) (*lock.Status, error) {
+	if m.StatusFunc != nil {
+		return m.StatusFunc(key)
+	}
+	return &lock.Status{}, nil
+}
@@ -0,0 +1,30 @@
+package locktest
+
+import (
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+)
+
+// SkewedClient wraps a client and simulates clock skew between the client
+// and the Redis server: remaining TTLs reported by PTTL are shifted by
+// Offset.
+type SkewedClient struct {
+	lock.RedisClient
+	Offset time.Duration
+}
+
+// PTTL returns the shifted TTL of key
+func (c *SkewedClient) PTTL(key string) *redis.DurationCmd {
+	ms, err := c.RedisClient.Eval(`return redis.call("pttl", KEYS[1])`, []string{key}).Int64()
+	ttl := time.Duration(ms) * time.Millisecond
+	if err != nil || ttl < 0 {
+		return redis.NewDurationResult(ttl, err)
+	}
+
+	if ttl += c.Offset; ttl < 0 {
+		ttl = 0
+	}
+	return redis.NewDurationResult(ttl, nil)
+}
@@ -0,0 +1,73 @@
+package locktest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	lock "github.com/bsm/redis-lock"
+)
+
+// RequireHeld fails the test immediately unless key is locked
+func RequireHeld(t testing.TB, client lock.RedisClient, key string) {
+	t.Helper()
+
+	if !locked(t, client, key) {
+		t.Fatalf("locktest: %q is not locked", key)
+	}
+}
+
+// RequireFree fails the test immediately if key is locked
+func RequireFree(t testing.TB, client lock.RedisClient, key string) {
+	t.Helper()
+
+	if locked(t, client, key) {
+		t.Fatalf("locktest: %q is locked", key)
+	}
+}
+
+// Contend calls fn with key from n goroutines at once and returns the
+// number of calls which succeeded. Calls which failed to get the lock,
+// i.e. with an error wrapping lock.ErrCannotGetLock, are not counted;
+// all other errors fail the test.
+func Contend(t testing.TB, n int, key string, fn func(key string) error) int {
+	t.Helper()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		wins  int
+		start = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			err := fn(key)
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err == nil {
+				wins++
+			} else if !errors.Is(err, lock.ErrCannotGetLock) {
+				t.Errorf("locktest: contending for %q: %v", key, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	return wins
+}
+
+func locked(t testing.TB, client lock.RedisClient, key string) bool {
+	t.Helper()
+
+	status, err := lock.NewLocksmith(client, nil).Status(key)
+	if err != nil {
+		t.Fatalf("locktest: status of %q: %v", key, err)
+	}
+	return status.Locked
+}
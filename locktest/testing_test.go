@@ -0,0 +1,88 @@
+package locktest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+)
+
+const testRedisKey = "__bsm_redis_lock_locktest_unit_test__"
+
+// recorder records failures instead of failing the test
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func newClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Network: "tcp", Addr: "127.0.0.1:6379", DB: 9})
+	if err := client.Ping().Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Del(testRedisKey).Err()
+		_ = client.Close()
+	})
+	return client
+}
+
+func TestRequireHeldAndFree(t *testing.T) {
+	client := newClient(t)
+
+	r := &recorder{TB: t}
+	RequireFree(r, client, testRedisKey)
+	RequireHeld(r, client, testRedisKey)
+	if exp := []string{`locktest: "` + testRedisKey + `" is not locked`}; fmt.Sprint(r.failures) != fmt.Sprint(exp) {
+		t.Fatalf("expected %v, got %v", exp, r.failures)
+	}
+
+	locker, err := lock.ObtainLock(client, testRedisKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Unlock()
+
+	r = &recorder{TB: t}
+	RequireHeld(r, client, testRedisKey)
+	RequireFree(r, client, testRedisKey)
+	if exp := []string{`locktest: "` + testRedisKey + `" is locked`}; fmt.Sprint(r.failures) != fmt.Sprint(exp) {
+		t.Fatalf("expected %v, got %v", exp, r.failures)
+	}
+}
+
+func TestContend(t *testing.T) {
+	client := newClient(t)
+
+	wins := Contend(t, 5, testRedisKey, func(key string) error {
+		return lock.RunWithLock(client, key, nil, func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+	})
+	if wins != 1 {
+		t.Fatalf("expected 1 win, got %d", wins)
+	}
+
+	r := &recorder{TB: t}
+	boom := errors.New("boom")
+	if wins := Contend(r, 2, testRedisKey, func(string) error { return boom }); wins != 0 {
+		t.Fatalf("expected no wins, got %d", wins)
+	}
+	if len(r.failures) != 2 {
+		t.Fatalf("expected 2 failures, got %v", r.failures)
+	}
+}
@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Middleware decorates a Locksmith with cross-cutting concerns, such as
+// metrics, logging, fault injection or quotas
+type Middleware func(Locksmith) Locksmith
+
+// Chain decorates smith with mws. The first middleware is the outermost,
+// it sees calls first.
+func Chain(smith Locksmith, mws ...Middleware) Locksmith {
+	for i := len(mws) - 1; i >= 0; i-- {
+		smith = mws[i](smith)
+	}
+	return smith
+}
+
+// Instrument reports the outcome and duration of every operation to
+// observe. Operations are "obtain", "run" and "status"; the duration of
+// "run" includes the handler.
+func Instrument(observe func(op, key string, took time.Duration, err error)) Middleware {
+	return func(next Locksmith) Locksmith {
+		return &instrumented{Locksmith: next, observe: observe}
+	}
+}
+
+type instrumented struct {
+	Locksmith
+	observe func(op, key string, took time.Duration, err error)
+}
+
+func (s *instrumented) Obtain(key string, opts *Options) (*Locker, error) {
+	start := time.Now()
+	locker, err := s.Locksmith.Obtain(key, opts)
+	s.observe("obtain", key, time.Since(start), err)
+	return locker, err
+}
+
+func (s *instrumented) Run(key string, opts *Options, handler func() error) error {
+	start := time.Now()
+	err := s.Locksmith.Run(key, opts, handler)
+	s.observe("run", key, time.Since(start), err)
+	return err
+}
+
+func (s *instrumented) Status(key string) (*Status, error) {
+	start := time.Now()
+	status, err := s.Locksmith.Status(key)
+	s.observe("status", key, time.Since(start), err)
+	return status, err
+}
+
+// Log logs failed operations via logf, e.g. log.Printf
+func Log(logf func(format string, args ...interface{})) Middleware {
+	return Instrument(func(op, key string, _ time.Duration, err error) {
+		if err != nil {
+			logf("lock: %s %q failed: %v", op, key, err)
+		}
+	})
+}
+
+// Chaos fails Obtain and Run with err at the given rate (0..1), without
+// touching Redis, to exercise error handling in tests and staging
+func Chaos(rate float64, err error) Middleware {
+	return func(next Locksmith) Locksmith {
+		return &chaos{Locksmith: next, rate: rate, err: err}
+	}
+}
+
+type chaos struct {
+	Locksmith
+	rate float64
+	err  error
+}
+
+func (s *chaos) Obtain(key string, opts *Options) (*Locker, error) {
+	if rand.Float64() < s.rate {
+		return nil, s.err
+	}
+	return s.Locksmith.Obtain(key, opts)
+}
+
+func (s *chaos) Run(key string, opts *Options, handler func() error) error {
+	if rand.Float64() < s.rate {
+		return s.err
+	}
+	return s.Locksmith.Run(key, opts, handler)
+}
+
+// MaxConcurrent limits the number of concurrent Run calls to n, excess
+// calls queue locally. Obtain is limited while acquiring only, as the
+// lifetime of the returned lock is not known; use Pool to limit held locks.
+func MaxConcurrent(n int) Middleware {
+	if n < 1 {
+		n = 1
+	}
+	return func(next Locksmith) Locksmith {
+		return &limited{Locksmith: next, slots: make(chan struct{}, n)}
+	}
+}
+
+type limited struct {
+	Locksmith
+	slots chan struct{}
+}
+
+func (s *limited) Obtain(key string, opts *Options) (*Locker, error) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	return s.Locksmith.Obtain(key, opts)
+}
+
+func (s *limited) Run(key string, opts *Options, handler func() error) error {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	return s.Locksmith.Run(key, opts, handler)
+}
@@ -0,0 +1,63 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrKeyspaceNotificationsDisabled is returned by EnsureKeyspaceNotifications
+// if the server does not publish the events required to observe lock releases
+var ErrKeyspaceNotificationsDisabled = errors.New("keyspace notifications for generic and expired events are disabled")
+
+// EnsureKeyspaceNotifications checks that notify-keyspace-events is
+// configured to publish DEL and expiry events for lock keys. If configure
+// is set, missing flags are added via CONFIG SET, otherwise
+// ErrKeyspaceNotificationsDisabled is returned and callers should fall back
+// to polling.
+func EnsureKeyspaceNotifications(ctx context.Context, client RedisClient, configure bool) error {
+	c, ok := client.(doer)
+	if !ok {
+		return ErrCommandsUnsupported
+	}
+
+	res, err := c.Do("config", "get", "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	var flags string
+	if pair, ok := res.([]interface{}); ok && len(pair) == 2 {
+		flags, _ = pair[1].(string)
+	}
+
+	missing := missingNotifyFlags(flags)
+	if missing == "" {
+		return nil
+	} else if !configure {
+		return ErrKeyspaceNotificationsDisabled
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Do("config", "set", "notify-keyspace-events", flags+missing).Err()
+}
+
+// missingNotifyFlags returns the flags which need to be added to enable
+// keyspace events for DEL and expired keys
+func missingNotifyFlags(flags string) string {
+	var missing string
+	if !strings.ContainsAny(flags, "KE") {
+		missing += "K"
+	}
+	if !strings.Contains(flags, "A") {
+		if !strings.Contains(flags, "g") {
+			missing += "g"
+		}
+		if !strings.Contains(flags, "x") {
+			missing += "x"
+		}
+	}
+	return missing
+}
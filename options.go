@@ -1,47 +1,557 @@
 package lock
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Effective defaults and bounds, applied by New()
+const (
+	// DefaultLockTimeout is used if Options.LockTimeout is not set
+	DefaultLockTimeout = 5 * time.Second
+	// MinLockTimeout is the resolution of lock timeouts, see Options.Validate
+	MinLockTimeout = time.Millisecond
+	// MinWaitRetry is the minimum (and default) Options.WaitRetry
+	MinWaitRetry = 10 * time.Millisecond
+	// DefaultWaitRetry is used if Options.WaitRetry is not set
+	DefaultWaitRetry = MinWaitRetry
+	// DefaultTopologyRetries is used if Options.TopologyRetries is not set
+	DefaultTopologyRetries = 3
+	// DefaultAttemptWindow is used if Options.AttemptWindow is not set
+	DefaultAttemptWindow = time.Second
+	// DefaultReplicaTimeout is used if Options.ReplicaTimeout is not set
+	DefaultReplicaTimeout = 100 * time.Millisecond
+	// DefaultStandbyPoll is used if Options.StandbyPoll is not set
+	DefaultStandbyPoll = time.Second
+)
+
+const (
+	// adaptiveRetrySlack is added to the holder TTL with AdaptiveRetry
+	adaptiveRetrySlack = 2 * time.Millisecond
+)
+
+// ErrInvalidTTL is returned by Options.Validate and Lock() if LockTimeout
+// is below the millisecond resolution of Redis
+var ErrInvalidTTL = errors.New("lock timeout below millisecond resolution")
+
+// RefreshMode controls how Lock() extends a held lock
+type RefreshMode int
+
+const (
+	// ResetTTL resets the TTL to LockTimeout
+	ResetTTL RefreshMode = iota
+	// ExtendBy adds LockTimeout to the remaining TTL
+	ExtendBy
+	// KeepTTL verifies ownership but keeps the remaining TTL
+	KeepTTL
+)
+
+// String returns the script argument for the mode
+func (m RefreshMode) String() string {
+	switch m {
+	case ExtendBy:
+		return "extend"
+	case KeepTTL:
+		return "keep"
+	default:
+		return "reset"
+	}
+}
+
+// DoubleUnlock controls how Unlock() behaves if the lock was already released
+type DoubleUnlock int
 
 const (
-	minWaitRetry   = 10 * time.Millisecond
-	minLockTimeout = 5 * time.Second
+	// IgnoreDoubleUnlock treats repeated calls as success
+	IgnoreDoubleUnlock DoubleUnlock = iota
+	// FailDoubleUnlock returns ErrAlreadyReleased
+	FailDoubleUnlock
+	// PanicDoubleUnlock panics with ErrAlreadyReleased, intended for debugging
+	PanicDoubleUnlock
 )
 
+// RetryDecision is returned by Options.ErrorClassifier
+type RetryDecision struct {
+	// Retry retries the attempt, otherwise Lock() aborts with the error
+	Retry bool
+
+	// Delay replaces the regular delay before the retry, if positive
+	Delay time.Duration
+}
+
+// Abort aborts Lock() with the error
+func Abort() RetryDecision {
+	return RetryDecision{}
+}
+
+// Retry retries after the regular delay
+func Retry() RetryDecision {
+	return RetryDecision{Retry: true}
+}
+
+// RetryIn retries after d
+func RetryIn(d time.Duration) RetryDecision {
+	return RetryDecision{Retry: true, Delay: d}
+}
+
 // Options describe the options for the lock
 type Options struct {
-	// The maximum duration to lock a key for
+	// The maximum duration to lock a key for. Durations below 1ms are
+	// rejected, durations of more than 24.8 days (2^31ms) are supported.
 	// Default: 5s
 	LockTimeout time.Duration
 
+	// RoundTTL rounds LockTimeout up to whole milliseconds, instead of
+	// rejecting sub-millisecond timeouts.
+	// Default: false
+	RoundTTL bool
+
 	// The maximum amount of time you are willing to wait to obtain that lock
 	// Default: 0 = do not wait
 	WaitTimeout time.Duration
 
 	// In case WaitTimeout is activated, this it the amount of time you are willing
 	// to wait between retries.
-	// Default: 100ms, must be at least 10ms
+	// Default: 10ms, must be at least 10ms
 	WaitRetry time.Duration
 
+	// Backoff computes the delay between retries, based on WaitRetry.
+	// Default: DefaultBackoff
+	Backoff Backoff
+
+	// StandbyPoll is the interval of the safety polls of Standby while it
+	// is subscribed to release notifications. They catch releases whose
+	// notifications were lost, e.g. during reconnects.
+	// Default: 1s
+	StandbyPoll time.Duration
+
+	// AdaptiveRetry schedules the next retry just after the remaining TTL of
+	// the current holder, instead of polling every WaitRetry. Falls back to
+	// Backoff if the TTL is unknown.
+	// Default: false
+	AdaptiveRetry bool
+
+	// AntiLivelock breaks livelocks between competing services. Failed
+	// attempts are recorded per contender (HolderID, if set) in
+	// key + ":intents". The contender with the most failures retries at
+	// twice the rate of WaitRetry, all others back off exponentially.
+	// Default: false
+	AntiLivelock bool
+
+	// DebugTrace records the decision of every acquisition attempt in a
+	// ring buffer of the given size, see Locker.DebugTrace.
+	// Default: 0 = disabled
+	DebugTrace int
+
 	// In case RetriesCount is activated, this it the count of retries.
 	// Default: 0
 	RetriesCount int
+
+	// RefreshMode controls how Lock() extends a lock which is already held.
+	// Default: ResetTTL
+	RefreshMode RefreshMode
+
+	// MaxQueueDepth enables the wait queue. Waiting lockers register in
+	// a queue (see QueueLength) and give up as soon as there are at
+	// least MaxQueueDepth waiters ahead of them.
+	// Default: 0 = disabled
+	MaxQueueDepth int
+
+	// Rotation registers the locker as participant id of a rotation, in
+	// key + ":participants". Participants take turns in the order of their
+	// ids, each holding the lock for at most one LockTimeout slice, which
+	// is not extended by refreshes. Participants which did not attempt
+	// to obtain the lock for two slices lose their turn.
+	// Default: none
+	Rotation string
+
+	// RetryOnError treats errors during acquisition attempts as failed
+	// attempts, which consume the retry budget instead of aborting Lock().
+	// The last error is returned if the budget is exhausted.
+	// Default: false
+	RetryOnError bool
+
+	// IsRetryable classifies errors if RetryOnError is enabled.
+	// Default: IsTransientError
+	IsRetryable func(error) bool
+
+	// ErrorClassifier decides whether an error during an acquisition
+	// attempt aborts Lock() or is retried, within WaitTimeout and
+	// RetriesCount. It takes precedence over RetryOnError and IsRetryable.
+	// Default: none
+	ErrorClassifier func(error) RetryDecision
+
+	// Audit records acquisitions, refreshes and releases in a capped
+	// Redis stream (key + ":audit"), see AuditExclusivity. Requires Redis 5+.
+	// Default: false
+	Audit bool
+
+	// Heartbeat writes a companion key (key + ":heartbeat") with the holder
+	// metadata and a timestamp on every acquisition and refresh,
+	// see LastHeartbeat.
+	// Default: false
+	Heartbeat bool
+
+	// HeartbeatGrace keeps heartbeats for longer than the lock itself, so
+	// the last holder of an expired lock can still be identified via
+	// LastHeartbeat. Heartbeats are removed immediately on release.
+	// Default: 0
+	HeartbeatGrace time.Duration
+
+	// OwnerID identifies the process across all of its locks, unlike the
+	// per-acquisition token. If set explicitly or with Reentrant or
+	// TrackOwner, it is stored in the metadata (MetaOwnerID), if supported
+	// by the Codec.
+	// Default: DefaultOwnerID()
+	OwnerID string
+
+	// Reentrant makes Lock() succeed if the lock is already held by the same
+	// OwnerID. The lock is not taken over: Unlock() of a reentered lock is
+	// a no-op, the lock is released by its original holder. Lock() and
+	// IsLocked() of a reentered lock fail once the original holder no longer
+	// holds it. Requires a Codec which stores metadata.
+	// Default: false
+	Reentrant bool
+
+	// TrackOwner tracks held locks per OwnerID, see HolderID.
+	// Default: false
+	TrackOwner bool
+
+	// HolderID identifies the holder (e.g. a worker) across locks. If set,
+	// held locks are tracked in a per-holder set.
+	// Default: OwnerID if TrackOwner or HolderQuota is set, none otherwise
+	HolderID string
+
+	// HolderQuota limits how many locks a HolderID may hold at the same
+	// time, further attempts fail with ErrHolderQuotaExceeded.
+	// Default: 0 = unlimited
+	HolderQuota int
+
+	// MinReplicas makes Lock() wait (WAIT) until the given number of replicas
+	// acknowledged the acquisition, see ErrNotReplicated. Ignored by servers
+	// which don't support WAIT.
+	// Default: 0 = don't wait
+	MinReplicas int
+
+	// ReplicaTimeout is the maximum time to wait for replicas.
+	// Default: 100ms
+	ReplicaTimeout time.Duration
+
+	// TopologyRetries is the number of times acquisitions and refreshes are
+	// retried on topology errors (see IsTopologyError), after resyncing the
+	// cluster state. Errors which persist are returned as *TopologyError.
+	// Default: 3, negative values disable retries
+	TopologyRetries int
+
+	// OnTopologyError is called on every topology error, e.g. to count
+	// failovers.
+	// Default: none
+	OnTopologyError func(error)
+
+	// AttemptLimit limits acquisition attempts on a key to AttemptLimit per
+	// AttemptWindow (sliding window, in key + ":attempts") across all
+	// clients. Excess attempts fail fast with ErrTooManyWaiters.
+	// Default: 0 = unlimited
+	AttemptLimit int
+
+	// AttemptWindow is the sliding window of AttemptLimit.
+	// Default: 1s
+	AttemptWindow time.Duration
+
+	// Breaker fails acquisitions fast while Redis is unhealthy.
+	// Share one Breaker across all lockers which use the same Redis.
+	// Default: none
+	Breaker *Breaker
+
+	// Failpoint is called at internal decision points, see Failpoint.
+	// If it returns an error, the operation fails with that error.
+	// Intended for deterministic fault injection in tests.
+	// Default: none
+	Failpoint func(Failpoint) error
+
+	// Codec controls how the token and metadata are stored.
+	// Default: PlainCodec
+	Codec ValueCodec
+
+	// AcceptLegacyValues makes all ownership checks (refresh, release,
+	// Adopt, ...) also accept locks which are stored as the plain token, as
+	// written by PlainCodec and by older versions. Enable it while switching Codec on services holding
+	// long-lived locks, so that a rolling upgrade doesn't lose them.
+	// Default: false
+	AcceptLegacyValues bool
+
+	// Metadata is stored along with the token, if supported by the Codec.
+	// Default: none
+	Metadata map[string]string
+
+	// TokenSecret signs tokens with HMAC-SHA256, so holders can be
+	// verified with VerifyToken and Holder rejects forged tokens. Refresh
+	// and release don't check signatures, anyone who knows the token of
+	// the current holder can still refresh or release the lock.
+	// Default: none
+	TokenSecret []byte
+
+	// TokenBytes is the number of random bytes (from crypto/rand) per token.
+	// Default: 16, must be at least 16
+	TokenBytes int
+
+	// TokenEncoding controls how tokens are encoded.
+	// Default: Base64Token
+	TokenEncoding TokenEncoding
+
+	// RequireDB makes Lock() fail fast with ErrDBMismatch unless the client
+	// uses the given logical DB, so services cannot unknowingly lock in
+	// different DBs. Use RequireDefaultDB to require DB 0.
+	// Default: 0 = no check
+	RequireDB int
+
+	// Environment tags lock values (e.g. "staging"). Lock() refuses to
+	// contend with holders tagged with a different environment and returns
+	// ErrEnvironmentMismatch instead. Requires a Codec which stores metadata.
+	// Default: none
+	Environment string
+
+	// Datacenter tags lock values with the datacenter of the holder, see
+	// PreferredDatacenter. Requires a Codec which stores metadata.
+	// Default: none
+	Datacenter string
+
+	// PreferredDatacenter is the active datacenter of an active/passive
+	// setup. Lockers of other datacenters only acquire once the lock was
+	// observed free for FailoverDelay, which avoids flapping across
+	// datacenters during brief partitions.
+	// Default: none = no preference
+	PreferredDatacenter string
+
+	// FailoverDelay is the confirmation delay of lockers outside the
+	// PreferredDatacenter. Keep WaitTimeout above it, or retry Lock().
+	// Default: LockTimeout
+	FailoverDelay time.Duration
+
+	// OnMissingTTL is called by Lock() if the lock is held by a key without
+	// expiry (PTTL -1), which would block contenders until removed, e.g.
+	// after a manual SET. repaired reports whether RepairMissingTTL applied.
+	// Default: none
+	OnMissingTTL func(key string, repaired bool)
+
+	// RepairMissingTTL applies LockTimeout to lock keys found without
+	// expiry, so they free themselves, see OnMissingTTL.
+	// Default: false
+	RepairMissingTTL bool
+
+	// OnStateChange is called on every lifecycle state transition, see State.
+	// It is called while the locker is busy and must not call its methods.
+	// Default: none
+	OnStateChange func(from, to State)
+
+	// OnClockStep is called by Lock() if the local wall clock stepped by
+	// a second or more since the previous call, e.g. after an NTP step,
+	// with the size of the step (negative if it went backwards). Locks are
+	// not affected, all local timing uses the monotonic clock, but wall
+	// clock timestamps (e.g. heartbeats) may be out of order.
+	// Default: none
+	OnClockStep func(step time.Duration)
+
+	// ExecutionTimeout bounds the run time of handlers of RunWithLock and
+	// RunWithLockContext, which would otherwise hold a refreshed lock
+	// forever. Once exceeded, the lock is released and ErrExecutionTimeout
+	// returned.
+	// Default: 0 = unbounded
+	ExecutionTimeout time.Duration
+
+	// DeadmanInterval releases a held lock instead of refreshing it, if
+	// the holder did not call Progress() within the interval since the
+	// acquisition or the last call, so a healthier replica can take over
+	// from a live-locked holder. Refreshes then fail with ErrDeadman.
+	// Default: 0 = disabled
+	DeadmanInterval time.Duration
+
+	// Webhook posts lifecycle events to an HTTP endpoint, see Webhook
+	// Default: none
+	Webhook *Webhook
+
+	// StrictOwnership makes Lock() fail with ErrLockLost if a held lock
+	// has expired, instead of silently obtaining a new one.
+	// Default: false
+	StrictOwnership bool
+
+	// TokenFile persists the token of a held lock to a local file, so that
+	// a quickly restarting process can re-adopt its lock instead of waiting
+	// for it to expire. The file is checksummed and removed on release.
+	// Default: none
+	TokenFile string
+
+	// DoubleUnlock controls how Unlock() behaves if called after the lock
+	// was already released.
+	// Default: IgnoreDoubleUnlock
+	DoubleUnlock DoubleUnlock
+
+	// StrictMode panics with a MisuseError on misuse, instead of silently
+	// proceeding: unlocking a locker which was never locked, extending a
+	// released lock and, in builds with the lockdebug tag, using a held
+	// locker from another goroutine than the one which obtained it.
+	// Intended for development and tests.
+	// Default: false
+	StrictMode bool
+
+	// SyncHandoff makes Unlock() block until a locker of this process, which
+	// was waiting for the lock, has been woken up and acquired it, for at most
+	// SyncHandoff. It allows deterministic assertions about handoffs in
+	// integration tests. Both holders and waiters must enable it.
+	// Default: 0 = disabled
+	SyncHandoff time.Duration
+
+	// ProfilerLabels applies pprof labels (LabelKey, LabelState) while
+	// RunWithLock and its variants wait for ("waiting") and hold ("held")
+	// the lock, so CPU profiles can be attributed to locked sections.
+	// Default: false
+	ProfilerLabels bool
+}
+
+// Merge returns a copy of the options with all non-zero fields of override applied
+func (o *Options) Merge(override *Options) *Options {
+	merged := new(Options)
+	if o != nil {
+		*merged = *o
+	}
+	if override == nil {
+		return merged
+	}
+
+	dst := reflect.ValueOf(merged).Elem()
+	src := reflect.ValueOf(override).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if field := src.Field(i); !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+	return merged
+}
+
+// OptionsResolver resolves options by key
+type OptionsResolver func(key string) *Options
+
+// PerKeyOptions returns a resolver which merges per-key overrides onto defaults
+func PerKeyOptions(defaults *Options, overrides map[string]*Options) OptionsResolver {
+	return func(key string) *Options {
+		return defaults.Merge(overrides[key])
+	}
+}
+
+// Validate checks the options for values which cannot be represented
+// in Redis. It is called by Lock().
+func (o *Options) Validate() error {
+	if o.LockTimeout > 0 && o.LockTimeout < MinLockTimeout {
+		return fmt.Errorf("%w: %s", ErrInvalidTTL, o.LockTimeout)
+	}
+	return nil
 }
 
 func (o *Options) normalize() *Options {
 	if o.LockTimeout < 1 {
-		o.LockTimeout = minLockTimeout
+		o.LockTimeout = DefaultLockTimeout
 	}
-	if o.WaitRetry < minWaitRetry {
-		o.WaitRetry = minWaitRetry
+	if o.RoundTTL {
+		if rem := o.LockTimeout % time.Millisecond; rem != 0 {
+			o.LockTimeout += time.Millisecond - rem
+		}
+	}
+	if o.WaitRetry < MinWaitRetry {
+		o.WaitRetry = MinWaitRetry
 	}
 	if o.RetriesCount < 0 {
 		o.RetriesCount = 0
 	}
+	if o.MaxQueueDepth < 0 {
+		o.MaxQueueDepth = 0
+	}
+	if o.TokenBytes < minTokenBytes {
+		o.TokenBytes = minTokenBytes
+	}
+	if o.HeartbeatGrace < 0 {
+		o.HeartbeatGrace = 0
+	}
+	if o.TopologyRetries == 0 {
+		o.TopologyRetries = DefaultTopologyRetries
+	} else if o.TopologyRetries < 0 {
+		o.TopologyRetries = 0
+	}
+	if o.AttemptWindow < MinLockTimeout {
+		o.AttemptWindow = DefaultAttemptWindow
+	}
+	if o.StandbyPoll < MinWaitRetry {
+		o.StandbyPoll = DefaultStandbyPoll
+	}
+	if o.ReplicaTimeout <= 0 {
+		o.ReplicaTimeout = DefaultReplicaTimeout
+	}
+	if o.HolderQuota < 0 {
+		o.HolderQuota = 0
+	}
 	if o.WaitTimeout < 0 {
 		o.WaitTimeout = 0
 	}
+	if o.Backoff == nil {
+		o.Backoff = DefaultBackoff
+	}
+	if o.IsRetryable == nil {
+		o.IsRetryable = IsTransientError
+	}
+	if o.OwnerID == "" {
+		o.OwnerID = DefaultOwnerID()
+	}
+	if o.HolderID == "" && (o.TrackOwner || o.HolderQuota > 0) {
+		o.HolderID = o.OwnerID
+	}
+	if o.FailoverDelay <= 0 {
+		o.FailoverDelay = o.LockTimeout
+	}
+	if o.Codec == nil && (o.Environment != "" || o.Datacenter != "" || o.Reentrant) {
+		o.Codec = VersionedCodec
+	}
+	if o.Codec == nil {
+		o.Codec = PlainCodec
+	}
+	if o.Rotation != "" {
+		o.RefreshMode = KeepTTL
+	}
 	if o.RetriesCount > 0 && o.WaitTimeout <= 0 {
 		o.WaitTimeout = o.WaitRetry * time.Duration(o.RetriesCount)
 	}
 	return o
 }
+
+// classify decides how to handle an error during an acquisition attempt
+func (o *Options) classify(err error) RetryDecision {
+	if o.ErrorClassifier != nil {
+		return o.ErrorClassifier(err)
+	}
+	if o.RetryOnError && o.IsRetryable(err) {
+		return Retry()
+	}
+	return Abort()
+}
+
+// IsTransientError returns true for network errors and for Redis errors
+// which are likely to resolve themselves, e.g. during failovers
+func IsTransientError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF || IsTopologyError(err) {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	msg := err.Error()
+	for _, prefix := range []string{"LOADING ", "READONLY ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN "} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
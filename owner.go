@@ -0,0 +1,64 @@
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// MetaOwnerID is the metadata key of the owner ID
+const MetaOwnerID = "owner"
+
+var defaultOwnerID struct {
+	id   string
+	once sync.Once
+}
+
+// DefaultOwnerID returns the owner ID of this process, which is used if
+// Options.OwnerID is not set: "<hostname>:<pid>:<random>". It is stable
+// across all locks of the process, unlike tokens.
+func DefaultOwnerID() string {
+	defaultOwnerID.once.Do(func() {
+		host, _ := os.Hostname()
+		if host == "" {
+			host = "unknown"
+		}
+
+		buf := make([]byte, 4)
+		_, _ = rand.Read(buf)
+		defaultOwnerID.id = host + ":" + strconv.Itoa(os.Getpid()) + ":" + hex.EncodeToString(buf)
+	})
+	return defaultOwnerID.id
+}
+
+// reenter reports whether the lock is held by our owner and returns the
+// token of the holder, see Options.Reentrant
+func (l *Locker) reenter() (string, bool) {
+	if !l.opts.Reentrant {
+		return "", false
+	}
+	holder, ok := l.holder()
+	if !ok || holder.Token == "" || holder.Metadata[MetaOwnerID] != l.opts.OwnerID {
+		return "", false
+	}
+	return holder.Token, true
+}
+
+// verifyReentered checks that a reentered lock is still held with the token
+// of the original holder. Otherwise, the locker is reset and left in the
+// Lost state.
+func (l *Locker) verifyReentered() (bool, error) {
+	if holder, ok := l.holder(); ok && holder.Token == l.reentered {
+		return true, nil
+	}
+	l.reset()
+	l.setState(Lost)
+	return false, ErrLockLost
+}
+
+// storesOwner reports whether the OwnerID is stored in the metadata
+func (l *Locker) storesOwner() bool {
+	return l.opts.Reentrant || l.opts.TrackOwner || l.opts.OwnerID != DefaultOwnerID()
+}
@@ -0,0 +1,193 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const luaMembership = luaServerTime + `local now = servertime()
+redis.call("zremrangebyscore", KEYS[1], "-inf", now)
+redis.call("zadd", KEYS[1], now + ARGV[2], ARGV[1])
+redis.call("pexpire", KEYS[1], ARGV[2])
+return redis.call("zcard", KEYS[1])`
+
+// ErrInvalidPartitions is returned by NewPartitioner if partitions is not positive
+var ErrInvalidPartitions = errors.New("number of partitions must be positive")
+
+// Partitioner distributes M partitions across processes. Each member holds
+// the locks of up to a fair share of ceil(M/members) partitions, members are
+// tracked via heartbeats in name + ":members". Call Rebalance periodically
+// (at least twice per Options.LockTimeout) or use Run.
+type Partitioner struct {
+	client     RedisClient
+	name       string
+	partitions int
+	member     string
+	opts       Options
+
+	held map[int]*Locker
+	mu   sync.Mutex
+}
+
+// NewPartitioner creates a partitioner for the given number of partitions,
+// member uniquely identifies the process
+func NewPartitioner(client RedisClient, name string, partitions int, member string, opts *Options) (*Partitioner, error) {
+	if partitions <= 0 {
+		return nil, ErrInvalidPartitions
+	}
+
+	once := opts.Merge(nil).normalize()
+	once.WaitTimeout, once.RetriesCount = 0, 0
+
+	return &Partitioner{
+		client:     client,
+		name:       name,
+		partitions: partitions,
+		member:     member,
+		opts:       *once,
+		held:       make(map[int]*Locker),
+	}, nil
+}
+
+// Partitions returns the partitions currently held, in ascending order
+func (p *Partitioner) Partitions() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.sorted()
+}
+
+// Rebalance sends a membership heartbeat, refreshes held partitions,
+// releases partitions beyond the fair share and tries to acquire free
+// partitions up to the fair share.
+func (p *Partitioner) Rebalance() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ttl := strconv.FormatInt(int64(p.opts.LockTimeout/time.Millisecond), 10)
+	members, err := eval(p.client, luaMembership, []string{p.membersKey()}, p.member, ttl).Int64()
+	if err != nil {
+		return err
+	}
+	share := (p.partitions + int(members) - 1) / int(members)
+
+	// Refresh held partitions, forget lost ones
+	for n, locker := range p.held {
+		if ok, err := locker.Lock(); err != nil {
+			return err
+		} else if !ok {
+			delete(p.held, n)
+		}
+	}
+
+	// Release partitions beyond the fair share
+	held := p.sorted()
+	for len(held) > share {
+		n := held[len(held)-1]
+		held = held[:len(held)-1]
+		if err := p.held[n].Unlock(); err != nil {
+			return err
+		}
+		delete(p.held, n)
+	}
+
+	// Acquire free partitions, starting at a member specific offset
+	offset := p.offset()
+	for i := 0; i < p.partitions && len(p.held) < share; i++ {
+		n := (offset + i) % p.partitions
+		if _, ok := p.held[n]; ok {
+			continue
+		}
+
+		locker := New(p.client, p.partitionKey(n), &p.opts)
+		if ok, err := locker.Lock(); err != nil {
+			return err
+		} else if ok {
+			p.held[n] = locker
+		}
+	}
+	return nil
+}
+
+// Run rebalances every interval until ctx is done, then calls Close.
+// onChange is called with the held partitions whenever they change.
+func (p *Partitioner) Run(ctx context.Context, interval time.Duration, onChange func([]int)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []int
+	for {
+		if err := p.Rebalance(); err != nil {
+			_ = p.Close()
+			return err
+		}
+		if current := p.Partitions(); onChange != nil && !equalInts(current, last) {
+			onChange(current)
+			last = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return p.Close()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close releases all partitions and leaves the membership
+func (p *Partitioner) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for n, locker := range p.held {
+		if e := locker.Unlock(); e != nil && err == nil {
+			err = e
+		}
+		delete(p.held, n)
+	}
+	if e := eval(p.client, luaDequeue, []string{p.membersKey()}, p.member).Err(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+func (p *Partitioner) sorted() []int {
+	held := make([]int, 0, len(p.held))
+	for n := range p.held {
+		held = append(held, n)
+	}
+	sort.Ints(held)
+	return held
+}
+
+func (p *Partitioner) offset() int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(p.member))
+	return int(h.Sum32() % uint32(p.partitions))
+}
+
+func (p *Partitioner) partitionKey(n int) string {
+	return p.name + ":" + strconv.Itoa(n)
+}
+
+func (p *Partitioner) membersKey() string {
+	return p.name + ":members"
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
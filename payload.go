@@ -0,0 +1,115 @@
+package lock
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+)
+
+const luaObtainPayload = `if not redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2]) then return {0} end
+return {1, redis.call("get", KEYS[2])}`
+
+const luaReleasePayload = `local v = redis.call("get", KEYS[1])
+if v ~= ARGV[1] and v ~= ARGV[3] then return 0 end
+redis.call("set", KEYS[2], ARGV[2])
+return redis.call("del", KEYS[1])`
+
+// payloadRead receives the payload read by the acquisition
+type payloadRead struct {
+	value string
+	read  bool
+}
+
+// GetAndLock is like Lock, but also returns the application payload stored
+// in key + ":payload", e.g. a checkpoint, which is empty if not set. The
+// payload is read in the same round trip as the acquisition, unless the
+// lock was already held or is tracked by HolderID or Rotation.
+func (l *Locker) GetAndLock() (string, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if sharded(l.client) && !hasHashTag(l.key) {
+		return "", false, ErrKeyNotHashTagged
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+	if l.token != "" {
+		ok, err = l.refresh(context.Background())
+	} else {
+		l.payload = new(payloadRead)
+		ok, err = l.create(context.Background())
+	}
+	payload := l.payload
+	l.payload = nil
+
+	recordError(err)
+	if err != nil || !ok {
+		return "", ok, err
+	} else if payload != nil && payload.read {
+		return payload.value, true, nil
+	}
+
+	value, err := eval(l.client, luaGet, []string{payloadKey(l.key)}).String()
+	if err == redis.Nil {
+		err = nil
+	}
+	return value, true, err
+}
+
+// UnlockWith stores value as payload (see GetAndLock) and releases the lock,
+// atomically. If the lock was lost, the payload is not written and
+// ErrLockLost is returned.
+func (l *Locker) UnlockWith(value string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if sharded(l.client) && !hasHashTag(l.key) {
+		return ErrKeyNotHashTagged
+	} else if l.token == "" {
+		return ErrLockLost
+	}
+
+	status, err := eval(l.client, luaReleasePayload, []string{l.key, payloadKey(l.key)}, append([]interface{}{l.value, value}, l.legacyValue()...)...).Result()
+	if err != nil {
+		return err
+	}
+
+	if status == int64(1) {
+		l.audit(AuditReleased)
+		l.clearHeartbeat()
+	}
+	l.releasedState(status == int64(1), nil)
+	l.removeToken()
+	err = l.untrack()
+	l.reset()
+
+	if status != int64(1) {
+		return ErrLockLost
+	}
+	return err
+}
+
+// obtainPayload acquires the lock and reads the payload
+func (l *Locker) obtainPayload(client RedisClient, value string) (bool, error) {
+	res, err := eval(client, luaObtainPayload, []string{l.key, payloadKey(l.key)}, value, l.ttlArg()).Result()
+	if err != nil {
+		return false, err
+	}
+
+	vals, _ := res.([]interface{})
+	if len(vals) == 0 || vals[0] != int64(1) {
+		return false, nil
+	}
+	if len(vals) > 1 {
+		l.payload.value, _ = vals[1].(string)
+	}
+	l.payload.read = true
+	return true, nil
+}
+
+func payloadKey(key string) string {
+	return key + ":payload"
+}
@@ -0,0 +1,115 @@
+package lock
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// adoptedTokenFiles holds the token files which have already been considered
+// for re-adoption by this process
+var adoptedTokenFiles sync.Map
+
+// persistedToken is the content of Options.TokenFile
+type persistedToken struct {
+	Key     string `json:"key"`
+	Token   string `json:"token"`
+	Value   string `json:"value"`
+	Process string `json:"process"`
+	CRC     uint32 `json:"crc"`
+}
+
+func (p *persistedToken) checksum() uint32 {
+	return crc32.ChecksumIEEE([]byte(p.Key + "\x00" + p.Token + "\x00" + p.Value + "\x00" + p.Process))
+}
+
+// persistToken atomically writes the current token to Options.TokenFile.
+// Persistence is best-effort, a missing file only prevents re-adoption.
+func (l *Locker) persistToken() {
+	if l.opts.TokenFile == "" {
+		return
+	}
+
+	p := &persistedToken{Key: l.key, Token: l.token, Value: l.value, Process: DefaultOwnerID()}
+	p.CRC = p.checksum()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.opts.TokenFile), filepath.Base(l.opts.TokenFile)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), l.opts.TokenFile)
+}
+
+// removeToken removes Options.TokenFile
+func (l *Locker) removeToken() {
+	if l.opts.TokenFile != "" {
+		_ = os.Remove(l.opts.TokenFile)
+	}
+}
+
+// adoptToken re-adopts a lock persisted to Options.TokenFile by a previous
+// process, if the file is intact, matches the key and the lock is still held
+// with the persisted token. Otherwise, the file is removed. Files written by
+// this process are never adopted and each file is adopted at most once per
+// process, so lockers sharing a TokenFile cannot both hold the lock.
+func (l *Locker) adoptToken() (bool, error) {
+	if l.opts.TokenFile == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(l.opts.TokenFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var p persistedToken
+	if err := json.Unmarshal(data, &p); err != nil || p.CRC != p.checksum() || p.Key != l.key {
+		l.removeToken()
+		return false, nil
+	}
+	if p.Process == DefaultOwnerID() {
+		return false, nil
+	}
+	path, err := filepath.Abs(l.opts.TokenFile)
+	if err != nil {
+		return false, err
+	}
+	if _, seen := adoptedTokenFiles.LoadOrStore(path, struct{}{}); seen {
+		return false, nil
+	}
+
+	v, err := l.opts.Codec.Decode(p.Value)
+	if err != nil {
+		return false, err
+	}
+	v.Token = p.Token
+
+	ok, err := l.adopt(p.Value, v)
+	if ok {
+		l.persistToken()
+	} else if err == nil {
+		l.removeToken()
+	}
+	return ok, err
+}
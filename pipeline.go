@@ -0,0 +1,112 @@
+package lock
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+)
+
+// Pending is a lock operation enqueued on a pipeline, see LockPipelined
+// and UnlockPipelined. Its result is available after the pipeline was executed.
+type Pending struct {
+	resolve func() (bool, error)
+}
+
+// Result resolves the operation, it must be called after the pipeline was
+// executed. For acquisitions, it reports whether the lock was obtained.
+// For releases, it reports whether the lock was still held. If a preloaded
+// script went missing (see PreloadScripts), Exec reports NOSCRIPT, but
+// Result retries the operation with EVAL.
+func (p *Pending) Result() (bool, error) {
+	return p.resolve()
+}
+
+// LockPipelined enqueues a single acquisition attempt on pipe (no waiting
+// or retries). The locker holds the lock once Result() reports success.
+func (l *Locker) LockPipelined(pipe redis.Pipeliner) (*Pending, error) {
+	if err := l.opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkTTLPolicy(l.opts.LockTimeout); err != nil {
+		return nil, err
+	}
+	if err := l.checkSharding(); err != nil {
+		return nil, err
+	}
+	if err := l.checkDB(); err != nil {
+		return nil, err
+	}
+
+	token, err := l.newToken()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := l.metadata(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	value, err := l.opts.Codec.Encode(Value{Token: token, Metadata: meta})
+	if err != nil {
+		return nil, err
+	}
+
+	start := monotime()
+	var result func() (bool, error)
+	if l.opts.HolderID != "" {
+		cmd := evalPiped(pipe, l.client, luaObtainTracked, l.trackingKeys(), value, l.ttlArg(), l.opts.HolderQuota)
+		result = func() (bool, error) {
+			status, err := cmd().Int64()
+			if err == nil && status == -1 {
+				err = ErrHolderQuotaExceeded
+			}
+			return status == 1, err
+		}
+	} else {
+		cmd := pipe.SetNX(l.key, value, l.opts.LockTimeout)
+		result = cmd.Result
+	}
+
+	return &Pending{resolve: func() (bool, error) {
+		ok, err := result()
+		if err == redis.Nil {
+			err = nil
+		}
+		if err != nil || !ok {
+			recordError(err)
+			return false, err
+		}
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		l.reset()
+		l.acquired(token, value, meta, start)
+		l.persistToken()
+		return true, nil
+	}}, nil
+}
+
+// UnlockPipelined enqueues the release of the lock on pipe
+func (l *Locker) UnlockPipelined(pipe redis.Pipeliner) *Pending {
+	l.mutex.Lock()
+	value, legacy := l.value, l.legacyValue()
+	l.mutex.Unlock()
+
+	cmd := evalPiped(pipe, l.client, luaRelease, []string{l.key}, append([]interface{}{value}, legacy...)...)
+	return &Pending{resolve: func() (bool, error) {
+		status, err := cmd().Int64()
+		if err == redis.Nil {
+			err = nil
+		}
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		if l.value == value {
+			err = l.afterRelease(status == 1, err)
+			l.reset()
+		}
+		recordError(err)
+		return status == 1, err
+	}}
+}
@@ -0,0 +1,37 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTTLOutOfBounds is returned by Lock() if LockTimeout violates the
+// bounds configured via SetTTLPolicy
+var ErrTTLOutOfBounds = errors.New("lock timeout out of bounds")
+
+var ttlPolicy struct {
+	sync.RWMutex
+	min, max time.Duration
+}
+
+// SetTTLPolicy configures process-wide bounds for Options.LockTimeout.
+// Lock attempts with a LockTimeout outside [min, max] are refused with
+// ErrTTLOutOfBounds. Zero disables the respective bound.
+func SetTTLPolicy(min, max time.Duration) {
+	ttlPolicy.Lock()
+	ttlPolicy.min, ttlPolicy.max = min, max
+	ttlPolicy.Unlock()
+}
+
+func checkTTLPolicy(ttl time.Duration) error {
+	ttlPolicy.RLock()
+	min, max := ttlPolicy.min, ttlPolicy.max
+	ttlPolicy.RUnlock()
+
+	if (min > 0 && ttl < min) || (max > 0 && ttl > max) {
+		return fmt.Errorf("%w: %s not within [%s, %s]", ErrTTLOutOfBounds, ttl, min, max)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool caps the number of locks a process attempts to obtain or holds at
+// the same time. Excess requests queue locally, without touching Redis,
+// which protects Redis from storms of lock attempts.
+type Pool struct {
+	factory *Factory
+	slots   chan struct{}
+}
+
+// NewPool creates a pool of size concurrent locks
+func NewPool(client RedisClient, size int, opts *Options) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		factory: NewFactory(client, opts),
+		slots:   make(chan struct{}, size),
+	}
+}
+
+// InUse returns the number of slots currently used by pending and held locks
+func (p *Pool) InUse() int {
+	return len(p.slots)
+}
+
+// Obtain waits for a free slot, then obtains the lock on key. If we can't
+// get a lock, it returns a `*LockError`. The slot is freed on Unlock().
+func (p *Pool) Obtain(ctx context.Context, key string) (*PooledLocker, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	locker := p.factory.For(key)
+	if ok, err := locker.LockContext(ctx); err != nil {
+		<-p.slots
+		return nil, err
+	} else if !ok {
+		<-p.slots
+		return nil, locker.LockError()
+	}
+	return &PooledLocker{Locker: locker, pool: p}, nil
+}
+
+// RunWithLock runs handler while holding the lock on key, see Obtain
+func (p *Pool) RunWithLock(ctx context.Context, key string, handler func() error) error {
+	locker, err := p.Obtain(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer locker.Unlock()
+
+	return handler()
+}
+
+// PooledLocker is a lock obtained from a Pool
+type PooledLocker struct {
+	*Locker
+
+	pool *Pool
+	once sync.Once
+}
+
+// Unlock releases the lock and frees its slot in the pool. The slot is
+// freed even if the lock was already lost.
+func (l *PooledLocker) Unlock() error {
+	err := l.Locker.Unlock()
+	l.once.Do(func() { <-l.pool.slots })
+	return err
+}
@@ -0,0 +1,80 @@
+package lock
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ProbablyHeld reports whether the lock is likely held, from local state
+// only: it is wait-free and needs no Redis round trip. The lock is assumed
+// held until LockTimeout after the start of the last successful acquisition
+// or refresh (including those of a Refresher), or until the remaining TTL set
+// by Drain. Locks which were deleted or taken over are not detected,
+// use Verify for an authoritative answer.
+func (l *Locker) ProbablyHeld() bool {
+	expiry := time.Duration(atomic.LoadInt64(&l.expiry))
+	return expiry > 0 && monotime() < expiry
+}
+
+// Verify checks with Redis whether the lock is still held. With
+// Options.AcceptLegacyValues, the plain token counts as held, too.
+func (l *Locker) Verify() (bool, error) {
+	l.mutex.Lock()
+	value, token := l.value, l.token
+	l.mutex.Unlock()
+
+	if value == "" {
+		return false, nil
+	}
+
+	raw, err := eval(l.client, luaGet, []string{l.key}).String()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return raw == value || (l.opts.AcceptLegacyValues && raw == token), err
+}
+
+// IsLockedFresh is like Verify, but trusts a confirmation by Redis which is
+// at most maxStale old, e.g. by the last acquisition, refresh or check.
+// Locks which are not held locally are reported without a round trip.
+// It suits dashboards polling many lockers.
+func (l *Locker) IsLockedFresh(maxStale time.Duration) (bool, error) {
+	if !l.ProbablyHeld() {
+		return false, nil
+	}
+
+	start := monotime()
+	if at := time.Duration(atomic.LoadInt64(&l.verifiedAt)); at > 0 && start-at <= maxStale {
+		return true, nil
+	}
+
+	ok, err := l.Verify()
+	if ok {
+		atomic.StoreInt64(&l.verifiedAt, int64(start))
+	}
+	return ok, err
+}
+
+// setExpiry records the local expiry of a lock (re-)acquired at start,
+// on the monotonic clock (see monotime)
+func (l *Locker) setExpiry(start, ttl time.Duration) {
+	atomic.StoreInt64(&l.verifiedAt, int64(start))
+	atomic.StoreInt64(&l.expiry, int64(start+ttl))
+}
+
+// extendExpiry records the local expiry after a refresh started at start
+func (l *Locker) extendExpiry(start time.Duration) {
+	atomic.StoreInt64(&l.verifiedAt, int64(start))
+	switch l.opts.RefreshMode {
+	case KeepTTL:
+		return
+	case ExtendBy:
+		if prev := time.Duration(atomic.LoadInt64(&l.expiry)); prev > start {
+			atomic.StoreInt64(&l.expiry, int64(prev+l.opts.LockTimeout))
+			return
+		}
+	}
+	l.setExpiry(start, l.opts.LockTimeout)
+}
@@ -0,0 +1,21 @@
+package lock
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Profiler label keys, see Options.ProfilerLabels
+const (
+	LabelKey   = "lock_key"
+	LabelState = "lock_state"
+)
+
+// profile runs fn with pprof labels for key and state added to ctx, if enabled
+func profile(ctx context.Context, opts *Options, key, state string, fn func(context.Context)) {
+	if opts == nil || !opts.ProfilerLabels {
+		fn(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels(LabelKey, key, LabelState, state), fn)
+}
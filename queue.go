@@ -0,0 +1,34 @@
+package lock
+
+import (
+	"strconv"
+	"time"
+)
+
+const luaEnqueue = luaServerTime + `redis.call("zadd", KEYS[1], "nx", servertime(), ARGV[1]) redis.call("pexpire", KEYS[1], ARGV[2]) return redis.call("zrank", KEYS[1], ARGV[1])`
+const luaDequeue = `return redis.call("zrem", KEYS[1], ARGV[1])`
+const luaQueueLength = `return redis.call("zcard", KEYS[1])`
+
+// QueueLength returns the number of lockers currently waiting for key.
+// Only lockers with Options.MaxQueueDepth enabled register as waiters.
+func QueueLength(client RedisClient, key string) (int, error) {
+	n, err := eval(client, luaQueueLength, []string{queueKey(key)}).Int64()
+	return int(n), err
+}
+
+// enqueue registers token as a waiter and returns the number of waiters ahead
+func (l *Locker) enqueue(token string) (int, error) {
+	ttl := strconv.FormatInt(int64((l.opts.WaitTimeout+l.opts.LockTimeout)/time.Millisecond), 10)
+	l.cost.script()
+	pos, err := eval(l.client, luaEnqueue, []string{queueKey(l.key)}, token, ttl).Int64()
+	return int(pos), err
+}
+
+func (l *Locker) dequeue(token string) error {
+	l.cost.script()
+	return eval(l.client, luaDequeue, []string{queueKey(l.key)}, token).Err()
+}
+
+func queueKey(key string) string {
+	return key + ":queue"
+}
@@ -0,0 +1,80 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrQuorumTimeout is returned by VerifyQuorum if the nodes did not answer
+// within the latency budget
+var ErrQuorumTimeout = errors.New("quorum not reached within latency budget")
+
+// VerifyQuorum checks that the lock is held with our value on a majority of
+// clients, e.g. the independent nodes of a Redlock setup, before entering
+// especially critical sections. Nodes are queried concurrently and it
+// returns as soon as the outcome is decided.
+//
+// The latency is bounded by the deadline of ctx and by the remaining Budget
+// carried by ctx (see ContextWithBudget), which is drawn from. A majority is
+// only accepted while the lock is still ProbablyHeld after all answers. If
+// no majority can be reached, it returns false and the first node error.
+func (l *Locker) VerifyQuorum(ctx context.Context, clients []*redis.Client) (bool, error) {
+	l.mutex.Lock()
+	value := l.value
+	l.mutex.Unlock()
+
+	if value == "" || len(clients) == 0 {
+		return false, nil
+	}
+
+	var timeout <-chan time.Time
+	start := time.Now()
+	if budget := BudgetFromContext(ctx); budget != nil {
+		defer func() { budget.consume(time.Since(start)) }()
+
+		timer := time.NewTimer(budget.Remaining())
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	answers := make(chan error, len(clients))
+	for _, client := range clients {
+		go func(client *redis.Client) {
+			raw, err := eval(client, luaGet, []string{l.key}).String()
+			if err == nil && raw != value {
+				err = redis.Nil
+			}
+			answers <- err
+		}(client)
+	}
+
+	quorum := len(clients)/2 + 1
+	var held, failed int
+	var firstErr error
+	for held < quorum && failed <= len(clients)-quorum {
+		select {
+		case err := <-answers:
+			if err == nil {
+				held++
+				continue
+			}
+
+			failed++
+			if firstErr == nil && err != redis.Nil {
+				firstErr = err
+			}
+		case <-timeout:
+			return false, ErrQuorumTimeout
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	if held < quorum {
+		return false, firstErr
+	}
+	return l.ProbablyHeld(), nil
+}
@@ -0,0 +1,47 @@
+package lock
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const luaAttempt = luaServerTime + `local now = servertime()
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - ARGV[2])
+if redis.call("zcard", KEYS[1]) >= tonumber(ARGV[3]) then return 0 end
+redis.call("zadd", KEYS[1], now, ARGV[1])
+redis.call("pexpire", KEYS[1], ARGV[2])
+return 1`
+
+// ErrTooManyWaiters is returned by Lock() if more than Options.AttemptLimit
+// attempts were made on the key within Options.AttemptWindow, fleet-wide
+var ErrTooManyWaiters = errors.New("too many acquisition attempts")
+
+// attemptSeq makes attempt IDs unique within the process
+var attemptSeq uint64
+
+// limitAttempt records an attempt in the sliding window of the key and
+// returns ErrTooManyWaiters if the limit is exceeded
+func (l *Locker) limitAttempt() error {
+	if l.opts.AttemptLimit <= 0 {
+		return nil
+	}
+
+	l.cost.script()
+	id := l.opts.OwnerID + ":" + strconv.FormatUint(atomic.AddUint64(&attemptSeq, 1), 10)
+	ok, err := eval(l.client, luaAttempt, []string{attemptsKey(l.key)}, id,
+		strconv.FormatInt(int64(l.opts.AttemptWindow/time.Millisecond), 10),
+		l.opts.AttemptLimit,
+	).Int64()
+	if err != nil {
+		return err
+	} else if ok == 0 {
+		return ErrTooManyWaiters
+	}
+	return nil
+}
+
+func attemptsKey(key string) string {
+	return key + ":attempts"
+}
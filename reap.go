@@ -0,0 +1,131 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrScanUnsupported is returned by Reap if the client cannot SCAN
+var ErrScanUnsupported = errors.New("client does not support SCAN")
+
+const luaReapSorted = luaServerTime + `return redis.call("zremrangebyscore", KEYS[1], "-inf", servertime() - ARGV[1])`
+
+type scanner interface {
+	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// Reap scans all keys matching prefix and removes companion entries which
+// were left behind by crashed processes:
+//
+//   - wait queue entries registered more than olderThan ago
+//   - heartbeats older than olderThan or without a lock, unless they are
+//     still within their Options.HeartbeatGrace
+//   - holder set entries which expired more than olderThan ago
+//   - acquisition attempts (Options.AttemptLimit) and rotation participants
+//     (Options.Rotation) recorded more than olderThan ago
+//   - scheduled acquisitions (LockAt) which expired more than olderThan ago
+//   - successor registrations and livelock intents of locks which are not held
+//   - rotation turns without participants
+//
+// Payloads (GetAndLock) are application state and never removed. It returns
+// the number of removed entries.
+func Reap(ctx context.Context, client RedisClient, prefix string, olderThan time.Duration) (int, error) {
+	sc, ok := client.(scanner)
+	if !ok {
+		return 0, ErrScanUnsupported
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	olderThanArg := strconv.FormatInt(int64(olderThan/time.Millisecond), 10)
+
+	var cursor uint64
+	var removed int
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		keys, next, err := sc.Scan(cursor, prefix+"*", 100).Result()
+		if err != nil {
+			return removed, err
+		}
+
+		for _, key := range keys {
+			n, err := reapKey(client, key, cutoff, olderThanArg)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+
+		if cursor = next; cursor == 0 {
+			return removed, nil
+		}
+	}
+}
+
+func reapKey(client RedisClient, key string, cutoff time.Time, olderThanArg string) (int, error) {
+	switch {
+	case hasAnySuffix(key, ":queue", ":attempts", ":participants", ":schedule"), strings.HasPrefix(key, holderKey("")):
+		n, err := eval(client, luaReapSorted, []string{key}, olderThanArg).Int64()
+		return int(n), err
+	case strings.HasSuffix(key, ":heartbeat"):
+		return reapHeartbeat(client, key, cutoff)
+	case strings.HasSuffix(key, ":successors"):
+		return reapOrphan(client, key, strings.TrimSuffix(key, ":successors"))
+	case strings.HasSuffix(key, ":intents"):
+		return reapOrphan(client, key, strings.TrimSuffix(key, ":intents"))
+	case strings.HasSuffix(key, ":turn"):
+		return reapOrphan(client, key, participantsKey(strings.TrimSuffix(key, ":turn")))
+	}
+	return 0, nil
+}
+
+func hasAnySuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reapOrphan removes key unless owner exists
+func reapOrphan(client RedisClient, key, owner string) (int, error) {
+	if ttl, err := pttl(client, owner); err != nil || ttl != -2*time.Millisecond {
+		return 0, err
+	}
+
+	n, err := eval(client, luaDel, []string{key}).Int64()
+	return int(n), err
+}
+
+func reapHeartbeat(client RedisClient, key string, cutoff time.Time) (int, error) {
+	lockKey := strings.TrimSuffix(key, ":heartbeat")
+	hb, err := LastHeartbeat(client, lockKey)
+	if err == ErrNotLocked {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	err = eval(client, luaGet, []string{lockKey}).Err()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	locked := err == nil
+
+	// Keep fresh heartbeats of held locks and heartbeats within their grace
+	// period, which expire on their own once the grace period is over
+	if (locked && hb.At.After(cutoff)) || (!locked && hb.Grace > 0) {
+		return 0, nil
+	}
+
+	n, err := eval(client, luaDel, []string{key}).Int64()
+	return int(n), err
+}
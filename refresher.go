@@ -0,0 +1,199 @@
+package lock
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrPipelineUnsupported is returned if the client cannot pipeline commands
+var ErrPipelineUnsupported = errors.New("client does not support pipelines")
+
+type pipeliner interface {
+	Pipeline() redis.Pipeliner
+}
+
+// Refresher keeps many locks alive by batching their refreshes into
+// a single pipeline per flush interval, instead of one round trip per lock.
+// Each lock is refreshed once half of its LockTimeout has elapsed. Companion
+// keys (e.g. Options.Heartbeat and Options.HolderID) are updated separately.
+type Refresher struct {
+	client   pipeliner
+	interval time.Duration
+	onError  func(error)
+
+	mu      sync.Mutex
+	lockers map[*Locker]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRefresher starts a refresher which flushes every interval.
+// Errors are passed to the optional onError.
+func NewRefresher(client RedisClient, interval time.Duration, onError func(error)) (*Refresher, error) {
+	p, ok := client.(pipeliner)
+	if !ok {
+		return nil, ErrPipelineUnsupported
+	}
+
+	r := &Refresher{
+		client:   p,
+		interval: interval,
+		onError:  onError,
+		lockers:  make(map[*Locker]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Add registers a held lock for refreshing. Locks which are released
+// or lost are removed automatically.
+func (r *Refresher) Add(l *Locker) {
+	r.mu.Lock()
+	r.lockers[l] = time.Now().Add(l.opts.LockTimeout / 2)
+	r.mu.Unlock()
+}
+
+// Remove stops refreshing a lock
+func (r *Refresher) Remove(l *Locker) {
+	r.mu.Lock()
+	delete(r.lockers, l)
+	r.mu.Unlock()
+}
+
+// Len returns the number of registered locks
+func (r *Refresher) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.lockers)
+}
+
+// Close stops the refresher
+func (r *Refresher) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Refresher) loop() {
+	defer close(r.done)
+
+	atomic.AddInt64(&stats.refreshLoops, 1)
+	defer atomic.AddInt64(&stats.refreshLoops, -1)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if err := r.flush(); err != nil && r.onError != nil {
+				r.onError(err)
+			}
+		}
+	}
+}
+
+type pendingRefresh struct {
+	locker *Locker
+	value  string
+	cmd    func() *redis.Cmd
+}
+
+// flush refreshes all locks which are due before the next flush
+func (r *Refresher) flush() error {
+	horizon := time.Now().Add(r.interval)
+
+	r.mu.Lock()
+	var due []*Locker
+	for l, at := range r.lockers {
+		if at.Before(horizon) {
+			due = append(due, l)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(due) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	defer pipe.Close()
+
+	pending := make([]pendingRefresh, 0, len(due))
+	for _, l := range due {
+		l.mutex.Lock()
+		value, ttl := l.value, strconv.FormatInt(int64(l.opts.LockTimeout/time.Millisecond), 10)
+		legacy := l.legacyValue()
+		l.mutex.Unlock()
+
+		if value == "" {
+			r.Remove(l)
+			continue
+		} else if l.deadmanExpired() {
+			r.Remove(l)
+			l.mutex.Lock()
+			if l.value == value {
+				_ = l.release()
+			}
+			l.mutex.Unlock()
+			continue
+		}
+		pending = append(pending, pendingRefresh{
+			locker: l,
+			value:  value,
+			cmd:    evalPiped(pipe, l.client, luaRefresh, []string{l.key}, append([]interface{}{value, ttl, l.opts.RefreshMode.String()}, legacy...)...),
+		})
+	}
+
+	now, start := time.Now(), monotime()
+	_, _ = pipe.Exec() // errors are resolved per command
+
+	var firstErr error
+	for _, p := range pending {
+		status, err := p.cmd().Int64()
+		if err != nil && err != redis.Nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if status == 1 {
+			r.mu.Lock()
+			if _, ok := r.lockers[p.locker]; ok {
+				r.lockers[p.locker] = now.Add(p.locker.opts.LockTimeout / 2)
+			}
+			r.mu.Unlock()
+
+			p.locker.mutex.Lock()
+			if p.locker.value == p.value {
+				err = p.locker.refreshed(start)
+			}
+			p.locker.mutex.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		// The lock was lost
+		r.Remove(p.locker)
+		p.locker.mutex.Lock()
+		if p.locker.value == p.value {
+			p.locker.setState(Lost)
+			p.locker.reset()
+		}
+		p.locker.mutex.Unlock()
+	}
+	return firstErr
+}
@@ -0,0 +1,155 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrUnknownLock is returned by Registry if a lock name was not defined
+var ErrUnknownLock = errors.New("unknown lock name")
+
+// Registry holds named lock definitions, so options are declared once per
+// lock type, in code or in a config file, instead of at every call site.
+// It is safe for concurrent use.
+type Registry struct {
+	client RedisClient
+	defs   map[string]*Factory
+	mu     sync.RWMutex
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry(client RedisClient) *Registry {
+	return &Registry{client: client, defs: make(map[string]*Factory)}
+}
+
+// Define declares (or replaces) the lock type name with opts
+func (r *Registry) Define(name string, opts *Options) {
+	factory := NewFactory(r.client, opts)
+
+	r.mu.Lock()
+	r.defs[name] = factory
+	r.mu.Unlock()
+}
+
+// Load defines the lock types of a JSON config, e.g.
+//
+//	{"locks": {"reports": {
+//	  "lock_timeout": "30s",
+//	  "wait_timeout": "5s",
+//	  "wait_retry": "100ms",
+//	  "retries": 3,
+//	  "refresh_mode": "extend"
+//	}}}
+//
+// Durations use time.ParseDuration syntax. Unknown fields are rejected.
+// YAML configs are supported by package registry/yaml.
+func (r *Registry) Load(rd io.Reader) error {
+	var config struct {
+		Locks map[string]definition `json:"locks"`
+	}
+	dec := json.NewDecoder(rd)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return err
+	}
+
+	opts := make(map[string]*Options, len(config.Locks))
+	for name, def := range config.Locks {
+		o, err := def.options()
+		if err != nil {
+			return fmt.Errorf("lock %q: %w", name, err)
+		}
+		opts[name] = o
+	}
+	for name, o := range opts {
+		r.Define(name, o)
+	}
+	return nil
+}
+
+// For creates a locker on key with the options of lock type name
+func (r *Registry) For(name, key string) (*Locker, error) {
+	factory, err := r.factory(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory.For(key), nil
+}
+
+// Obtain is like ObtainLock, with the options of lock type name
+func (r *Registry) Obtain(name, key string) (*Locker, error) {
+	factory, err := r.factory(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := factory.Options()
+	return obtainLock(r.client, key, &opts)
+}
+
+// Run is like RunWithLock, with the options of lock type name
+func (r *Registry) Run(name, key string, handler func() error) error {
+	factory, err := r.factory(name)
+	if err != nil {
+		return err
+	}
+
+	opts := factory.Options()
+	return RunWithLock(r.client, key, &opts, handler)
+}
+
+func (r *Registry) factory(name string) (*Factory, error) {
+	r.mu.RLock()
+	factory, ok := r.defs[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLock, name)
+	}
+	return factory, nil
+}
+
+// definition is a lock type in config files
+type definition struct {
+	LockTimeout string `json:"lock_timeout"`
+	WaitTimeout string `json:"wait_timeout"`
+	WaitRetry   string `json:"wait_retry"`
+	Retries     int    `json:"retries"`
+	RefreshMode string `json:"refresh_mode"`
+}
+
+func (d definition) options() (*Options, error) {
+	o := &Options{RetriesCount: d.Retries}
+	for _, f := range []struct {
+		src string
+		dst *time.Duration
+	}{
+		{d.LockTimeout, &o.LockTimeout},
+		{d.WaitTimeout, &o.WaitTimeout},
+		{d.WaitRetry, &o.WaitRetry},
+	} {
+		if f.src == "" {
+			continue
+		}
+		v, err := time.ParseDuration(f.src)
+		if err != nil {
+			return nil, err
+		}
+		*f.dst = v
+	}
+
+	switch d.RefreshMode {
+	case "", ResetTTL.String():
+	case ExtendBy.String():
+		o.RefreshMode = ExtendBy
+	case KeepTTL.String():
+		o.RefreshMode = KeepTTL
+	default:
+		return nil, fmt.Errorf("unknown refresh mode %q", d.RefreshMode)
+	}
+	return o, o.Validate()
+}
@@ -0,0 +1,32 @@
+// Package yaml loads lock.Registry definitions from YAML configs, e.g.
+//
+//	locks:
+//	  reports:
+//	    lock_timeout: 30s
+//	    wait_timeout: 5s
+//	    wait_retry: 100ms
+//	    retries: 3
+//	    refresh_mode: extend
+//
+// The fields are the same as in JSON configs, see lock.Registry.Load.
+package yaml
+
+import (
+	"bytes"
+	"io"
+
+	lock "github.com/bsm/redis-lock"
+	"sigs.k8s.io/yaml"
+)
+
+// Load defines the lock types of a YAML (or JSON) config in registry
+func Load(registry *lock.Registry, rd io.Reader) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	if data, err = yaml.YAMLToJSON(data); err != nil {
+		return err
+	}
+	return registry.Load(bytes.NewReader(data))
+}
@@ -0,0 +1,44 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	lock "github.com/bsm/redis-lock"
+	"github.com/go-redis/redis"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	var registry *lock.Registry
+
+	BeforeEach(func() {
+		registry = lock.NewRegistry(redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"}))
+	})
+
+	It("should define locks from YAML", func() {
+		Expect(Load(registry, strings.NewReader(`
+locks:
+  reports:
+    lock_timeout: 30s
+    refresh_mode: extend
+`))).To(Succeed())
+
+		locker, err := registry.For("reports", "key")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locker.Options().LockTimeout).To(Equal(30 * time.Second))
+		Expect(locker.Options().RefreshMode).To(Equal(lock.ExtendBy))
+	})
+
+	It("should reject invalid configs", func() {
+		Expect(Load(registry, strings.NewReader("locks: [\n"))).NotTo(Succeed())
+		Expect(Load(registry, strings.NewReader("locks:\n  reports:\n    timeout: 1s\n"))).NotTo(Succeed())
+	})
+})
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "redis-lock/registry/yaml")
+}
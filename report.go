@@ -0,0 +1,77 @@
+package lock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RunReport describes the execution of a locked section, see RunWithReport
+type RunReport struct {
+	// Wait is the time spent obtaining the lock
+	Wait time.Duration
+
+	// Hold is the time the handler ran while holding the lock
+	Hold time.Duration
+
+	// Refreshes is the number of background refreshes
+	Refreshes int
+
+	// Lost is true if the lock was lost while the handler was running
+	Lost bool
+
+	// Cost is the Redis load of obtaining the lock
+	Cost AcquisitionCost
+}
+
+// RunWithReport is like RunWithLock, but the lock is refreshed in the
+// background while handler is running (see LockUntilDone). It returns
+// a report for telemetry, even if the lock could not be obtained.
+func RunWithReport(client RedisClient, key string, opts *Options, handler func() error) (*RunReport, error) {
+	var onStateChange func(from, to State)
+	if opts != nil {
+		onStateChange = opts.OnStateChange
+	}
+
+	var refreshes, lost int32
+	merged := opts.Merge(&Options{OnStateChange: func(from, to State) {
+		switch {
+		case from == Refreshing && to == Held:
+			atomic.AddInt32(&refreshes, 1)
+		case to == Lost:
+			atomic.StoreInt32(&lost, 1)
+		}
+		if onStateChange != nil {
+			onStateChange(from, to)
+		}
+	}})
+
+	var (
+		report = new(RunReport)
+		locker = New(client, key, merged)
+		err    error
+	)
+	start := time.Now()
+	profile(context.Background(), opts, key, "waiting", func(context.Context) {
+		var ok bool
+		if ok, err = locker.Lock(); err == nil && !ok {
+			err = locker.LockError()
+		}
+	})
+	report.Wait = time.Since(start)
+	report.Cost = locker.AcquisitionCost()
+	if err != nil {
+		return report, err
+	}
+
+	stop := locker.keepAliveBackground(context.Background())
+
+	start = time.Now()
+	profile(context.Background(), opts, key, "held", func(context.Context) { err = handler() })
+	report.Hold = time.Since(start)
+	stop()
+
+	report.Refreshes = int(atomic.LoadInt32(&refreshes))
+	report.Lost = atomic.LoadInt32(&lost) == 1
+	return report, err
+}
@@ -0,0 +1,52 @@
+package lock
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrKeyNotHashTagged is returned by Lock() if a sharded client
+// (redis.Ring, redis.ClusterClient) is used with options which require
+// companion keys (queues, audit streams, heartbeats), but the key has no
+// hash tag. Use e.g. KeyBuilder{HashTag: true} to build keys.
+var ErrKeyNotHashTagged = errors.New("key requires a hash tag with sharded clients")
+
+// ErrHolderTrackingSharded is returned by Lock() if Options.HolderID is
+// used with a sharded client, as the per-holder set cannot be colocated
+// with all locks of the holder.
+var ErrHolderTrackingSharded = errors.New("holder tracking is not supported with sharded clients")
+
+// sharded returns true if client distributes keys across shards
+func sharded(client RedisClient) bool {
+	switch client.(type) {
+	case *redis.Ring, *redis.ClusterClient:
+		return true
+	}
+	return false
+}
+
+// hasHashTag returns true if key contains a non-empty hash tag, e.g. "{id}"
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	return strings.IndexByte(key[start+1:], '}') > 0
+}
+
+// checkSharding ensures that the lock and its companion keys map to
+// the same shard, if the client is sharded
+func (l *Locker) checkSharding() error {
+	if !sharded(l.client) {
+		return nil
+	}
+	if l.opts.HolderID != "" {
+		return ErrHolderTrackingSharded
+	}
+	if (l.opts.MaxQueueDepth > 0 || l.opts.Rotation != "" || l.opts.Audit || l.opts.Heartbeat || l.opts.AntiLivelock) && !hasHashTag(l.key) {
+		return ErrKeyNotHashTagged
+	}
+	return nil
+}
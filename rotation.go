@@ -0,0 +1,45 @@
+package lock
+
+const luaRotate = luaServerTime + `local now = servertime()
+local window = tonumber(ARGV[3]) * 2
+redis.call("zadd", KEYS[2], now, ARGV[1])
+redis.call("zremrangebyscore", KEYS[2], "-inf", now - window)
+redis.call("pexpire", KEYS[2], window)
+if redis.call("exists", KEYS[1]) == 1 then return 0 end
+local ids = redis.call("zrange", KEYS[2], 0, -1)
+table.sort(ids)
+local last, turn = redis.call("get", KEYS[3]), ids[1]
+if last then
+	for _, id in ipairs(ids) do
+		if id > last then turn = id break end
+	end
+end
+if turn ~= ARGV[1] then return 0 end
+redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+redis.call("set", KEYS[3], ARGV[1], "px", window)
+return 1`
+
+// LeaveRotation removes the locker from the participants of its rotation
+// (see Options.Rotation), so others don't have to wait for its turn to
+// time out. It does not release a held lock.
+func (l *Locker) LeaveRotation() error {
+	if l.opts.Rotation == "" {
+		return nil
+	}
+	return eval(l.client, luaDequeue, []string{participantsKey(l.key)}, l.opts.Rotation).Err()
+}
+
+// rotate attempts to obtain the lock for the slice of our turn
+func (l *Locker) rotate(client RedisClient, value string) (bool, error) {
+	keys := []string{l.key, participantsKey(l.key), turnKey(l.key)}
+	n, err := eval(client, luaRotate, keys, l.opts.Rotation, value, l.ttlArg()).Int64()
+	return n == 1, err
+}
+
+func participantsKey(key string) string {
+	return key + ":participants"
+}
+
+func turnKey(key string) string {
+	return key + ":turn"
+}
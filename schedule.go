@@ -0,0 +1,137 @@
+package lock
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const luaSchedule = luaServerTime + `local due = servertime() + tonumber(ARGV[2])
+local member = due .. ":" .. ARGV[1]
+local ttl = tonumber(ARGV[2]) + tonumber(ARGV[3])
+redis.call("zadd", KEYS[1], due + tonumber(ARGV[3]), member)
+if redis.call("pttl", KEYS[1]) < ttl then redis.call("pexpire", KEYS[1], ttl) end
+return member`
+
+const luaYield = luaServerTime + `local now = servertime()
+redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+for _, m in ipairs(redis.call("zrange", KEYS[2], 0, -1)) do
+	local due, id = string.match(m, "^(%d+):(.*)$")
+	if id ~= ARGV[2] and tonumber(due) <= now then
+		if redis.call("get", KEYS[1]) == ARGV[1] then redis.call("del", KEYS[1]) end
+		return 1
+	end
+end
+return 0`
+
+const luaObtainOrYield = luaServerTime + `if redis.call("exists", KEYS[2]) == 1 then
+	local now = servertime()
+	redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+	for _, m in ipairs(redis.call("zrange", KEYS[2], 0, -1)) do
+		local due, id = string.match(m, "^(%d+):(.*)$")
+		if id ~= ARGV[3] and tonumber(due) <= now then return 0 end
+	end
+end
+if not redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2]) then return 0 end
+return 1`
+
+// LockAt is like Lock, but acquires the lock at t. The acquisition is
+// registered in key + ":schedule" until then. From t on, lockers which
+// had to wait yield to the scheduled acquisition, so it takes priority
+// over casual waiters. Options.WaitTimeout applies from t.
+func (l *Locker) LockAt(t time.Time) (bool, error) {
+	return l.LockAtContext(context.Background(), t)
+}
+
+// LockAfter is like LockAt, but acquires the lock after d
+func (l *Locker) LockAfter(d time.Duration) (bool, error) {
+	return l.LockAt(time.Now().Add(d))
+}
+
+// LockAtContext is like LockAt, but stops waiting as soon as ctx is done
+func (l *Locker) LockAtContext(ctx context.Context, t time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if sharded(l.client) && !hasHashTag(l.key) {
+		return false, ErrKeyNotHashTagged
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+
+	// Register the acquisition, it expires if we don't get the lock in time
+	delay := time.Until(t)
+	if delay < 0 {
+		delay = 0
+	}
+	window := l.opts.WaitTimeout + l.opts.WaitRetry
+	member, err := eval(l.client, luaSchedule, []string{scheduleKey(l.key)}, id,
+		strconv.FormatInt(int64(delay/time.Millisecond), 10),
+		strconv.FormatInt(int64(window/time.Millisecond), 10),
+	).String()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = eval(l.client, luaDequeue, []string{scheduleKey(l.key)}, member).Err()
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-timer.C:
+	}
+
+	l.mutex.Lock()
+	l.scheduleID = id
+	l.mutex.Unlock()
+	defer func() {
+		l.mutex.Lock()
+		l.scheduleID = ""
+		l.mutex.Unlock()
+	}()
+
+	return l.LockContext(ctx)
+}
+
+// schedulable reports whether the lock yields to scheduled acquisitions
+func (l *Locker) schedulable() bool {
+	return l.opts.HolderID == "" && (!sharded(l.client) || hasHashTag(l.key))
+}
+
+// plainAcquire reports whether acquisitions are plain SET NX commands.
+// Their retries check for scheduled acquisitions in the same script, see
+// obtainOrYield, others yield after the fact.
+func (l *Locker) plainAcquire() bool {
+	return l.opts.MinReplicas == 0 && l.opts.Rotation == "" && l.opts.HolderID == "" && l.payload == nil
+}
+
+// obtainOrYield obtains the lock, unless another scheduled acquisition is
+// due. The schedule is only read if it exists.
+func (l *Locker) obtainOrYield(value string) (bool, error) {
+	l.cost.script()
+	n, err := eval(l.client, luaObtainOrYield, []string{l.key, scheduleKey(l.key)}, value, l.ttlArg(), l.scheduleID).Int64()
+	return n == 1, err
+}
+
+// yieldToSchedule releases a freshly obtained lock again, if another
+// scheduled acquisition is due. It reports whether the lock was released.
+func (l *Locker) yieldToSchedule(value string) bool {
+	if !l.schedulable() {
+		return false
+	}
+
+	l.cost.script()
+	yielded, err := eval(l.client, luaYield, []string{l.key, scheduleKey(l.key)}, value, l.scheduleID).Int64()
+	return err == nil && yielded == 1
+}
+
+func scheduleKey(key string) string {
+	return key + ":schedule"
+}
@@ -0,0 +1,160 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrScriptLoadUnsupported is returned by PreloadScripts if the client
+// cannot load scripts
+var ErrScriptLoadUnsupported = errors.New("client does not support SCRIPT LOAD")
+
+// ErrScriptsDisabled is returned by operations which require Lua scripts,
+// if the package was built with the nolua tag
+var ErrScriptsDisabled = errors.New("operation requires Lua scripts")
+
+// scripts maps all Lua scripts used by this package to operation names
+var scripts = map[string]string{
+	luaRefresh:          "lock:refresh",
+	luaRelease:          "lock:release",
+	luaEnqueue:          "lock:enqueue",
+	luaDequeue:          "lock:dequeue",
+	luaQueueLength:      "lock:queue-length",
+	luaGet:              "lock:get",
+	luaSetPX:            "lock:set",
+	luaStatus:           "lock:status",
+	luaAudit:            "lock:audit",
+	luaAuditRange:       "lock:audit-range",
+	luaDel:              "lock:del",
+	luaPTTL:             "lock:pttl",
+	luaPublish:          "lock:publish",
+	luaObtainTracked:    "lock:acquire",
+	luaTrack:            "lock:track",
+	luaUntrack:          "lock:untrack",
+	luaReapSorted:       "lock:reap",
+	luaExtendIfExpiring: "lock:extend",
+	luaHeldBy:           "lock:held-by",
+	luaLockedPop:        "lock:locked-pop",
+	luaIntent:           "lock:intent",
+	luaMembership:       "lock:membership",
+	luaObtain:           "lock:obtain",
+	luaSchedule:         "lock:schedule",
+	luaYield:            "lock:yield",
+	luaObtainOrYield:    "lock:obtain-or-yield",
+	luaTransfer:         "lock:transfer",
+	luaSuccessorAdd:     "lock:register-successor",
+	luaSuccessorDel:     "lock:unregister-successor",
+	luaAttempt:          "lock:attempt",
+	luaRotate:           "lock:rotate",
+	luaObtainPayload:    "lock:get-and-lock",
+	luaReleasePayload:   "lock:unlock-with",
+	luaRepairTTL:        "lock:repair-ttl",
+}
+
+// scriptSHAs maps SHA1 digests to operation names
+var scriptSHAs = func() map[string]string {
+	m := make(map[string]string, len(scripts))
+	for src, name := range scripts {
+		m[scriptSHA(src)] = name
+	}
+	return m
+}()
+
+// pinnedSHAs maps script sources to their preloaded SHA1 digests
+var pinnedSHAs sync.Map
+
+type scriptLoader interface {
+	ScriptLoad(script string) *redis.StringCmd
+}
+
+type shaEvaler interface {
+	EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd
+}
+
+// PreloadScripts loads all Lua scripts into the Redis script cache and pins
+// their SHAs, so subsequent lock operations use EVALSHA. Operations fall
+// back to EVAL transparently if the script cache was flushed (e.g. after
+// a failover). With redis.Ring, scripts are loaded on every shard.
+func PreloadScripts(ctx context.Context, client RedisClient) error {
+	switch c := client.(type) {
+	case *redis.Ring:
+		return c.ForEachShard(func(shard *redis.Client) error {
+			return PreloadScripts(ctx, shard)
+		})
+	case *redis.ClusterClient:
+		return c.ForEachNode(func(node *redis.Client) error {
+			return PreloadScripts(ctx, node)
+		})
+	}
+
+	loader, ok := client.(scriptLoader)
+	if !ok {
+		return ErrScriptLoadUnsupported
+	}
+
+	for src := range scripts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sha, err := loader.ScriptLoad(src).Result()
+		if err != nil {
+			return err
+		}
+		pinnedSHAs.Store(src, sha)
+	}
+	return nil
+}
+
+func isNoScript(err error) bool {
+	return strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// OperationName returns the name of the lock operation (e.g. "lock:refresh")
+// for EVAL/EVALSHA/FCALL commands issued by this package. It can be used in
+// tracing or metrics hooks (e.g. client.WrapProcess) to attribute commands.
+// Lock acquisitions without holder tracking are issued as SET NX commands
+// and labelled "lock:obtain", like all other SET NX commands of the client.
+func OperationName(cmd redis.Cmder) (string, bool) {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return "", false
+	}
+
+	name, _ := args[0].(string)
+	arg, _ := args[1].(string)
+	switch strings.ToLower(name) {
+	case "setnx":
+		return scripts[luaObtain], true
+	case "set":
+		for i := 3; i < len(args); i++ {
+			if s, _ := args[i].(string); strings.EqualFold(s, "nx") {
+				return scripts[luaObtain], true
+			}
+		}
+	case "eval":
+		name, ok := scripts[arg]
+		return name, ok
+	case "evalsha":
+		name, ok := scriptSHAs[arg]
+		return name, ok
+	case "fcall":
+		for src, name := range scripts {
+			if functionName(src) == arg {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func scriptSHA(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// SharedDo ensures that only one caller across all processes executes fn
+// for key at a time. Concurrent callers block until fn has completed and
+// then receive the same result, which is kept in Redis for ttl.
+// The lock is held for at most ttl while fn is running. If fn fails, its
+// error is returned to the executing caller only and one of the waiting
+// callers will take over. Waiting callers give up with the context error
+// once ctx is done.
+func SharedDo(ctx context.Context, client RedisClient, key string, ttl time.Duration, fn func() ([]byte, error)) ([]byte, error) {
+	locker := New(client, key, &Options{LockTimeout: ttl})
+	resultKey := key + ":result"
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		if res, err := sharedResult(client, resultKey); err != nil || res != nil {
+			return res, err
+		}
+
+		ok, err := locker.LockContext(ctx)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(locker.opts.WaitRetry)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		res, err := sharedExec(client, resultKey, ttl, fn)
+		if uerr := locker.Unlock(); err == nil {
+			err = uerr
+		}
+		return res, err
+	}
+}
+
+func sharedExec(client RedisClient, resultKey string, ttl time.Duration, fn func() ([]byte, error)) ([]byte, error) {
+	// Someone else may have completed while we were acquiring the lock
+	if res, err := sharedResult(client, resultKey); err != nil || res != nil {
+		return res, err
+	}
+
+	res, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	px := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+	if err := eval(client, luaSetPX, []string{resultKey}, res, px).Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func sharedResult(client RedisClient, resultKey string) ([]byte, error) {
+	res, err := eval(client, luaGet, []string{resultKey}).String()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return []byte(res), nil
+}
@@ -0,0 +1,105 @@
+package lock
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+type psubscriber interface {
+	PSubscribe(channels ...string) *redis.PubSub
+}
+
+// Standby waits in the background until key becomes available and acquires
+// it immediately. The returned channel receives the locker once it holds the
+// lock and is closed afterwards, or when ctx is done.
+//
+// Standby reacts within milliseconds to releases announced on key + ":events"
+// (see Drain) and to DEL/expiry keyspace notifications (see
+// EnsureKeyspaceNotifications). Notifications are not persisted by Redis,
+// so the key is checked again whenever the subscription is confirmed,
+// which covers releases between the first check and the subscription as
+// well as reconnects, and every Options.StandbyPoll. It falls back to
+// polling every Options.WaitRetry if the client cannot subscribe.
+func Standby(ctx context.Context, client RedisClient, key string, opts *Options) <-chan *Locker {
+	once := opts.Merge(nil)
+	once.WaitTimeout, once.RetriesCount = 0, 0
+	locker := New(client, key, once)
+	locker.cost.cumulative = true
+
+	acquired := make(chan *Locker, 1)
+	go func() {
+		defer close(acquired)
+
+		poll := locker.opts.WaitRetry
+		var wakeup <-chan struct{}
+		if ps, ok := client.(psubscriber); ok {
+			sub := ps.PSubscribe(globEscape(eventsChannel(key)), "__keyspace@*__:"+globEscape(key))
+			defer sub.Close()
+
+			done := make(chan struct{})
+			defer close(done)
+
+			poll = locker.opts.StandbyPoll
+			wakeup = receiveWakeups(sub, locker.opts.WaitRetry, done, &locker.cost)
+		}
+
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		for {
+			if ok, err := locker.LockContext(ctx); err == nil && ok {
+				acquired <- locker
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-wakeup:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return acquired
+}
+
+// receiveWakeups signals on every message and every (re-)confirmation of
+// the subscription. Receive errors are signalled after retry, so a broken
+// subscription degrades to polling. Messages are counted in cost.
+func receiveWakeups(sub *redis.PubSub, retry time.Duration, done <-chan struct{}, cost *costCounter) <-chan struct{} {
+	wakeup := make(chan struct{}, 1)
+	go func() {
+		for {
+			msg, err := sub.Receive()
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if err != nil {
+				time.Sleep(retry)
+			} else if _, ok := msg.(*redis.Pong); ok {
+				continue
+			} else if _, ok := msg.(*redis.Message); ok {
+				cost.message()
+			}
+
+			select {
+			case wakeup <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return wakeup
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// globEscape escapes s for use in PSUBSCRIBE patterns
+func globEscape(s string) string {
+	return globEscaper.Replace(s)
+}
@@ -0,0 +1,58 @@
+package lock
+
+import "sync/atomic"
+
+// State is the lifecycle state of a Locker
+type State int32
+
+const (
+	// Unlocked is the initial state, the lock is not held
+	Unlocked State = iota
+	// Acquiring is set while Lock() tries to obtain the lock
+	Acquiring
+	// Held is set once the lock is obtained
+	Held
+	// Refreshing is set while a held lock is refreshed
+	Refreshing
+	// Lost is set when a lock expired or was taken over by someone else
+	Lost
+	// Released is set when the lock was released by Unlock()
+	Released
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Acquiring:
+		return "acquiring"
+	case Held:
+		return "held"
+	case Refreshing:
+		return "refreshing"
+	case Lost:
+		return "lost"
+	case Released:
+		return "released"
+	default:
+		return "unlocked"
+	}
+}
+
+// State returns the current lifecycle state of the lock
+func (l *Locker) State() State {
+	return State(atomic.LoadInt32(&l.state))
+}
+
+func (l *Locker) setState(s State) {
+	prev := State(atomic.SwapInt32(&l.state, int32(s)))
+	if prev == s {
+		return
+	}
+	if s == Held && prev != Refreshing {
+		l.Progress()
+	}
+	if l.opts.OnStateChange != nil {
+		l.opts.OnStateChange(prev, s)
+	}
+	l.webhook(prev, s)
+}
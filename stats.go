@@ -0,0 +1,108 @@
+package lock
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the process-wide lock statistics
+type Stats struct {
+	// Held is the number of currently held locks
+	Held int64 `json:"held"`
+
+	// Pending is the number of acquisitions in progress
+	Pending int64 `json:"pending"`
+
+	// RefreshLoops is the number of running background refresh loops
+	RefreshLoops int64 `json:"refresh_loops"`
+
+	// TokenCollisions is the number of detected token collisions,
+	// see ErrTokenCollision
+	TokenCollisions int64 `json:"token_collisions"`
+
+	// MissingTTL is the number of lock keys found without expiry,
+	// see Options.OnMissingTTL
+	MissingTTL int64 `json:"missing_ttl"`
+
+	// Acquisitions is the number of acquisitions, successful or not
+	Acquisitions int64 `json:"acquisitions"`
+
+	// AcquisitionAttempts, AcquisitionCommands, AcquisitionScripts and
+	// AcquisitionMessages add up the AcquisitionCost of all acquisitions
+	AcquisitionAttempts int64 `json:"acquisition_attempts"`
+	AcquisitionCommands int64 `json:"acquisition_commands"`
+	AcquisitionScripts  int64 `json:"acquisition_scripts"`
+	AcquisitionMessages int64 `json:"acquisition_messages"`
+
+	// LastError is the last error returned by a lock operation
+	LastError string `json:"last_error,omitempty"`
+
+	// LastErrorAt is the time of LastError, nil if there was none
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+var stats struct {
+	held, pending, refreshLoops, tokenCollisions, missingTTL int64
+
+	acquisitions, acquisitionAttempts, acquisitionCommands, acquisitionScripts, acquisitionMessages int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// ReadStats returns the current process-wide lock statistics
+func ReadStats() Stats {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	s := Stats{
+		Held:            atomic.LoadInt64(&stats.held),
+		Pending:         atomic.LoadInt64(&stats.pending),
+		RefreshLoops:    atomic.LoadInt64(&stats.refreshLoops),
+		TokenCollisions: atomic.LoadInt64(&stats.tokenCollisions),
+		MissingTTL:      atomic.LoadInt64(&stats.missingTTL),
+
+		Acquisitions:        atomic.LoadInt64(&stats.acquisitions),
+		AcquisitionAttempts: atomic.LoadInt64(&stats.acquisitionAttempts),
+		AcquisitionCommands: atomic.LoadInt64(&stats.acquisitionCommands),
+		AcquisitionScripts:  atomic.LoadInt64(&stats.acquisitionScripts),
+		AcquisitionMessages: atomic.LoadInt64(&stats.acquisitionMessages),
+		LastError:           stats.lastError,
+	}
+	if !stats.lastErrorAt.IsZero() {
+		at := stats.lastErrorAt
+		s.LastErrorAt = &at
+	}
+	return s
+}
+
+// PublishExpvar publishes the statistics as an expvar with the given name,
+// e.g. PublishExpvar("redislock"). It panics if the name is already taken.
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return ReadStats() }))
+}
+
+// DebugHandler returns an http.Handler serving the statistics as JSON,
+// to be mounted on a debug mux
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ReadStats())
+	})
+}
+
+func recordError(err error) {
+	if err == nil {
+		return
+	}
+
+	stats.mu.Lock()
+	stats.lastError = err.Error()
+	stats.lastErrorAt = time.Now()
+	stats.mu.Unlock()
+}
@@ -0,0 +1,30 @@
+package lock
+
+// MisuseError is the panic value of misuse detected in Options.StrictMode
+type MisuseError struct {
+	Key    string
+	Op     string
+	Reason string
+}
+
+// Error implements error
+func (e *MisuseError) Error() string {
+	return "lock: misuse of " + e.Key + " in " + e.Op + ": " + e.Reason
+}
+
+// misuse panics with a MisuseError in StrictMode
+func (l *Locker) misuse(op, reason string) {
+	if l.opts.StrictMode {
+		panic(&MisuseError{Key: l.key, Op: op, Reason: reason})
+	}
+}
+
+// sharedGoroutine detects held lockers used by other goroutines than the
+// one which obtained them, in StrictMode and lockdebug builds only
+func (l *Locker) sharedGoroutine() bool {
+	if !l.opts.StrictMode || l.token == "" || l.goroutine == 0 {
+		return false
+	}
+	id := goroutineID()
+	return id != 0 && id != l.goroutine
+}
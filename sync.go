@@ -0,0 +1,42 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+type syncLocker struct {
+	locker *Locker
+	block  bool
+}
+
+// SyncLocker returns a sync.Locker backed by the lock.
+// If the lock cannot be obtained, Lock() panics, unless block is set,
+// in which case it keeps retrying every WaitRetry until it succeeds.
+// Unlock() panics if the lock cannot be released.
+func (l *Locker) SyncLocker(block bool) sync.Locker {
+	return &syncLocker{locker: l, block: block}
+}
+
+func (s *syncLocker) Lock() {
+	for {
+		ok, err := s.locker.Lock()
+		if err == nil && ok {
+			return
+		}
+
+		if !s.block {
+			if err == nil {
+				err = s.locker.LockError()
+			}
+			panic("redis-lock: " + err.Error())
+		}
+		time.Sleep(s.locker.opts.WaitRetry)
+	}
+}
+
+func (s *syncLocker) Unlock() {
+	if err := s.locker.Unlock(); err != nil {
+		panic("redis-lock: " + err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package lock
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// TenantKey returns the key namespace of tenantID, e.g. "tenant:{3}:acme".
+// Tenants are assigned to one of shards via jump consistent hashing, so
+// increasing shards only moves the minimal number of tenants. The shard is
+// a hash tag, all keys of a tenant map to the same Redis Cluster slot.
+func TenantKey(tenantID string, shards int) string {
+	return "tenant:{" + strconv.Itoa(tenantShard(tenantID, shards)) + "}:" + tenantID
+}
+
+// tenantShard implements the jump consistent hash by Lamping and Veach
+func tenantShard(tenantID string, shards int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(tenantID))
+	key := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(shards) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	if b < 0 {
+		return 0
+	}
+	return int(b)
+}
+
+// TenantLocker creates lockers scoped to the namespace of a tenant,
+// see TenantKey
+type TenantLocker struct {
+	*Factory
+	namespace string
+}
+
+// NewTenantLocker creates a tenant locker
+func NewTenantLocker(client RedisClient, tenantID string, shards int, opts *Options) *TenantLocker {
+	return &TenantLocker{
+		Factory:   NewFactory(client, opts),
+		namespace: TenantKey(tenantID, shards),
+	}
+}
+
+// Key returns the full key of key within the tenant namespace
+func (t *TenantLocker) Key(key string) string {
+	return t.namespace + ":" + key
+}
+
+// For creates a new lock on key within the tenant namespace
+func (t *TenantLocker) For(key string) *Locker {
+	return t.Factory.For(t.Key(key))
+}
+
+// RunWithLock runs handler while holding the lock on key within the
+// tenant namespace, see RunWithLock
+func (t *TenantLocker) RunWithLock(key string, handler func() error) error {
+	opts := t.Options()
+	return RunWithLock(t.client, t.Key(key), &opts, handler)
+}
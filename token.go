@@ -0,0 +1,78 @@
+package lock
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrTokenCollision is returned by Lock() if the lock is held with the
+// token which was generated for this attempt. This indicates a broken
+// randomness source, collisions are counted in Stats.TokenCollisions.
+var ErrTokenCollision = errors.New("token collision")
+
+// TokenEncoding controls how random tokens are encoded
+type TokenEncoding int
+
+const (
+	// Base64Token encodes tokens as URL-safe base64
+	Base64Token TokenEncoding = iota
+	// HexToken encodes tokens as lower-case hex
+	HexToken
+)
+
+// minTokenBytes is the minimum (and default) entropy of tokens
+const minTokenBytes = 16
+
+// ErrInvalidToken is returned by Holder if Options.TokenSecret is set
+// and the token of the current holder is not signed with it
+var ErrInvalidToken = errors.New("invalid token signature")
+
+// VerifyToken reports whether token was issued for key by a locker
+// configured with the given TokenSecret. Signatures are compared in
+// constant time.
+func VerifyToken(key, token string, secret []byte) bool {
+	pos := strings.LastIndexByte(token, '.')
+	if pos < 0 {
+		return false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(token[pos+1:])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, tokenSignature(key, token[:pos], secret))
+}
+
+// newToken creates a random token, signed if a TokenSecret is configured
+func (l *Locker) newToken() (string, error) {
+	buf := make([]byte, l.opts.TokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	var token string
+	switch l.opts.TokenEncoding {
+	case HexToken:
+		token = hex.EncodeToString(buf)
+	default:
+		token = base64.URLEncoding.EncodeToString(buf)
+	}
+
+	if len(l.opts.TokenSecret) == 0 {
+		return token, nil
+	}
+	return token + "." + base64.RawURLEncoding.EncodeToString(tokenSignature(l.key, token, l.opts.TokenSecret)), nil
+}
+
+func tokenSignature(key, token string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
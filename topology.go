@@ -0,0 +1,61 @@
+package lock
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// TopologyError wraps errors caused by cluster topology changes or by
+// writes to replicas (MOVED, ASK, READONLY, CLUSTERDOWN, TRYAGAIN), which
+// were still failing after Options.TopologyRetries. Its message is the
+// message of the wrapped error.
+type TopologyError struct {
+	Err error
+}
+
+// Error implements error
+func (e *TopologyError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the wrapped error
+func (e *TopologyError) Unwrap() error { return e.Err }
+
+// IsTopologyError returns true for errors caused by cluster topology
+// changes or by writes to replicas
+func IsTopologyError(err error) bool {
+	var te *TopologyError
+	if errors.As(err, &te) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, prefix := range []string{"MOVED ", "ASK ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN "} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTopologyRetry runs op and retries topology errors after resyncing
+// the cluster state. Errors which persist are wrapped in a TopologyError.
+func (l *Locker) withTopologyRetry(op func() error) error {
+	err := op()
+	for i := 0; err != nil && err != redis.Nil && IsTopologyError(err); i++ {
+		if l.opts.OnTopologyError != nil {
+			l.opts.OnTopologyError(err)
+		}
+		if i >= l.opts.TopologyRetries {
+			return &TopologyError{Err: err}
+		}
+
+		if cluster, ok := l.client.(*redis.ClusterClient); ok {
+			_ = cluster.ReloadState()
+		}
+		time.Sleep(MinWaitRetry)
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+// Trace actions, see TraceEntry
+const (
+	TraceAcquired  = "acquired"
+	TraceRetry     = "retry"
+	TraceTimeout   = "timeout"
+	TraceExhausted = "retries exhausted"
+	TraceQueueFull = "queue full"
+	TraceMismatch  = "environment mismatch"
+	TraceCanceled  = "canceled"
+	TraceError     = "error"
+)
+
+// TraceEntry records the decision taken after a single acquisition attempt
+type TraceEntry struct {
+	// At is the time of the attempt
+	At time.Time
+
+	// Attempt is the 1-based attempt number within Lock()
+	Attempt int
+
+	// KeyPresent is true if the lock was held by someone else
+	KeyPresent bool
+
+	// TTL is the remaining TTL of the holder, if the key was present
+	TTL time.Duration
+
+	// Err is the error of the attempt, if any
+	Err error
+
+	// Action is the decision taken, e.g. TraceRetry
+	Action string
+
+	// Sleep is the delay before the next attempt, for TraceRetry
+	Sleep time.Duration
+}
+
+// traceRing is a fixed-size ring buffer of trace entries
+type traceRing struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+func (r *traceRing) add(e TraceEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *traceRing) snapshot() []TraceEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]TraceEntry(nil), r.entries[:r.next]...)
+	}
+	return append(append([]TraceEntry(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// DebugTrace returns the most recent wait loop decisions, oldest first.
+// It returns nil unless Options.DebugTrace is set.
+func (l *Locker) DebugTrace() []TraceEntry {
+	if l.trace == nil {
+		return nil
+	}
+	return l.trace.snapshot()
+}
+
+// traceAttempt records the decision after an attempt, if tracing is enabled
+func (l *Locker) traceAttempt(attempt int, ok bool, err error, action string, sleep time.Duration) {
+	if l.trace == nil {
+		return
+	}
+
+	e := TraceEntry{
+		At:         time.Now(),
+		Attempt:    attempt,
+		KeyPresent: !ok && err == nil,
+		Err:        err,
+		Action:     action,
+		Sleep:      sleep,
+	}
+	if e.KeyPresent {
+		e.TTL = l.holderTTL()
+	}
+	l.trace.add(e)
+}
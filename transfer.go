@@ -0,0 +1,117 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const luaTransfer = `local cur = redis.call("get", KEYS[1])
+if cur ~= ARGV[1] and cur ~= ARGV[4] then return 0 end
+local v = redis.call("hget", KEYS[2], ARGV[2])
+if not v then return -1 end
+redis.call("hdel", KEYS[2], ARGV[2])
+redis.call("set", KEYS[1], v, "px", ARGV[3])
+return 1`
+
+const luaSuccessorAdd = `redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
+if redis.call("pttl", KEYS[1]) < tonumber(ARGV[3]) then redis.call("pexpire", KEYS[1], ARGV[3]) end
+return 1`
+
+const luaSuccessorDel = `return redis.call("hdel", KEYS[1], ARGV[1])`
+
+// ErrNoSuccessor is returned by ReleaseTo if the successor is not registered.
+// The lock is still held.
+var ErrNoSuccessor = errors.New("successor not registered")
+
+// RegisterSuccessor registers the locker as successor id of the lock, in
+// key + ":successors". Once the holder calls ReleaseTo(id), the lock is
+// reserved for this locker, which takes over on its next attempt in
+// Lock(). The registration is renewed by every Lock() and removed once
+// the lock was obtained.
+func (l *Locker) RegisterSuccessor(id string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if sharded(l.client) && !hasHashTag(l.key) {
+		return ErrKeyNotHashTagged
+	}
+
+	token, err := l.newToken()
+	if err != nil {
+		return err
+	}
+	meta, err := l.metadata(context.Background())
+	if err != nil {
+		return err
+	}
+	value, err := l.opts.Codec.Encode(Value{Token: token, Metadata: meta})
+	if err != nil {
+		return err
+	}
+
+	l.successor = &successor{id: id, token: token, value: value, meta: meta}
+	return l.registerSuccessor()
+}
+
+// ReleaseTo releases the lock to the registered successor id, without
+// a gap. The lock is reserved for the successor for LockTimeout, no one
+// else can obtain it in the meantime.
+func (l *Locker) ReleaseTo(id string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" {
+		return ErrLockLost
+	}
+
+	status, err := eval(l.client, luaTransfer, []string{l.key, successorsKey(l.key)}, append([]interface{}{l.value, id, l.ttlArg()}, l.legacyValue()...)...).Int64()
+	if err != nil {
+		return err
+	} else if status == -1 {
+		return ErrNoSuccessor
+	}
+
+	if status == 1 {
+		l.audit(AuditReleased)
+		l.clearHeartbeat()
+	}
+	l.releasedState(status == 1, nil)
+	l.removeToken()
+	err = l.untrack()
+	l.reset()
+
+	if status == 0 {
+		return ErrLockLost
+	}
+	return err
+}
+
+type successor struct {
+	id, token, value string
+	meta             map[string]string
+}
+
+// registerSuccessor (re-)registers the successor value
+func (l *Locker) registerSuccessor() error {
+	ttl := strconv.FormatInt(int64((l.opts.WaitTimeout+l.opts.LockTimeout)/time.Millisecond), 10)
+	return eval(l.client, luaSuccessorAdd, []string{successorsKey(l.key)}, l.successor.id, l.successor.value, ttl).Err()
+}
+
+// adoptTransfer takes over a lock which was transferred to us, see adopt
+func (l *Locker) adoptTransfer(value string) (bool, error) {
+	l.cost.script()
+	return l.adopt(value, Value{Token: l.successor.token, Metadata: l.successor.meta})
+}
+
+// unregisterSuccessor removes the registration once the lock is held
+func (l *Locker) unregisterSuccessor() {
+	l.cost.script()
+	_ = eval(l.client, luaSuccessorDel, []string{successorsKey(l.key)}, l.successor.id).Err()
+	l.successor = nil
+}
+
+func successorsKey(key string) string {
+	return key + ":successors"
+}
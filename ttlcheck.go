@@ -0,0 +1,49 @@
+package lock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const luaRepairTTL = `if redis.call("pttl", KEYS[1]) ~= -1 then return 0 end
+return redis.call("pexpire", KEYS[1], ARGV[1])`
+
+// ttlReading is the PTTL of the lock key, see keyTTL
+type ttlReading struct {
+	ttl   time.Duration
+	err   error
+	valid bool
+}
+
+// keyTTL returns the PTTL of the lock key. Within an acquisition attempt,
+// it is read once and shared by all checks, until the key is written.
+func (l *Locker) keyTTL() (time.Duration, error) {
+	if !l.observed.valid {
+		l.cost.command()
+		ttl, err := pttl(l.client, l.key)
+		l.observed = ttlReading{ttl: ttl, err: err, valid: true}
+	}
+	return l.observed.ttl, l.observed.err
+}
+
+// checkTTL detects lock keys without expiry, which block all contenders
+// until removed, e.g. after manual edits or a corrupted release. They are
+// counted in Stats.MissingTTL, reported to Options.OnMissingTTL and given
+// LockTimeout as expiry if Options.RepairMissingTTL is set.
+func (l *Locker) checkTTL() {
+	ttl, err := l.keyTTL()
+	if err != nil || ttl != -time.Millisecond {
+		return
+	}
+	atomic.AddInt64(&stats.missingTTL, 1)
+
+	repaired := false
+	if l.opts.RepairMissingTTL {
+		l.cost.script()
+		n, err := eval(l.client, luaRepairTTL, []string{l.key}, l.ttlArg()).Int64()
+		repaired = err == nil && n == 1
+	}
+	if l.opts.OnMissingTTL != nil {
+		l.opts.OnMissingTTL(l.key, repaired)
+	}
+}
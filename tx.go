@@ -0,0 +1,60 @@
+package lock
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// ObtainInTx is a shortcut for New().LockInTx(). It returns a *LockError
+// if the lock is already held. The locker uses client once the
+// transaction has completed.
+func ObtainInTx(client RedisClient, tx *redis.Tx, key string, opts *Options, fn func(pipe redis.Pipeliner) error) (*Locker, error) {
+	locker := New(client, key, opts)
+	if ok, err := locker.LockInTx(tx, fn); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, locker.LockError()
+	}
+	return locker, nil
+}
+
+// LockInTx acquires the lock as part of an optimistic transaction, so the
+// lock and the changes queued by fn commit atomically. It watches the lock
+// key and reports false if the lock is already held (no waiting or
+// retries). Use it within client.Watch(), which must be retried if the
+// transaction fails with redis.TxFailedErr.
+func (l *Locker) LockInTx(tx *redis.Tx, fn func(pipe redis.Pipeliner) error) (bool, error) {
+	if err := tx.Watch(l.key).Err(); err != nil {
+		return false, err
+	}
+
+	if n, err := tx.Exists(l.key).Result(); err != nil {
+		return false, err
+	} else if n != 0 {
+		l.mutex.Lock()
+		l.retryAfter = l.holderTTL()
+		l.mutex.Unlock()
+		return false, nil
+	}
+
+	var pending *Pending
+	cmds, err := tx.Pipelined(func(pipe redis.Pipeliner) error {
+		var err error
+		if pending, err = l.LockPipelined(pipe); err != nil {
+			return err
+		}
+		if fn != nil {
+			return fn(pipe)
+		}
+		return nil
+	})
+	if cmds == nil {
+		return false, err
+	}
+
+	// Resolve the acquisition, even if one of the queued commands failed
+	ok, perr := pending.Result()
+	if err == nil {
+		err = perr
+	}
+	return ok, err
+}
@@ -0,0 +1,44 @@
+package lock
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+)
+
+type pinger interface {
+	Ping() *redis.StatusCmd
+}
+
+// Warmup establishes connections to all nodes and preloads the Lua scripts
+// (see PreloadScripts), so that the latency of the first Lock() isn't
+// dominated by dialing and TLS handshakes. Call it before timed
+// acquisitions with a small WaitTimeout.
+func (l *Locker) Warmup(ctx context.Context) error {
+	if err := dial(l.client); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil || !scriptsEnabled {
+		return err
+	}
+
+	if err := PreloadScripts(ctx, l.client); err != ErrScriptLoadUnsupported {
+		return err
+	}
+	return nil
+}
+
+// dial pings every node of client
+func dial(client RedisClient) error {
+	ping := func(c *redis.Client) error { return c.Ping().Err() }
+
+	switch c := client.(type) {
+	case *redis.Ring:
+		return c.ForEachShard(ping)
+	case *redis.ClusterClient:
+		return c.ForEachNode(ping)
+	case pinger:
+		return c.Ping().Err()
+	}
+	return nil
+}
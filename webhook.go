@@ -0,0 +1,149 @@
+package lock
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Webhook event names
+const (
+	WebhookAcquired = "acquired"
+	WebhookReleased = "released"
+	WebhookExpired  = "expired"
+	WebhookStolen   = "stolen"
+)
+
+// WebhookSignatureHeader carries the HMAC-SHA256 signature of the request
+// body as "sha256=<hex>", if Webhook.Secret is set
+const WebhookSignatureHeader = "X-Lock-Signature"
+
+// Webhook posts lock lifecycle events to an HTTP endpoint, for consumers
+// which don't talk to Redis. Events are delivered asynchronously and
+// best-effort: they may arrive out of order and are dropped once all
+// retries failed. Whether a lost lock expired or was stolen is determined
+// after the fact and may be inaccurate if the key changed in between.
+type Webhook struct {
+	// URL receives the events as JSON encoded WebhookEvent POST requests
+	URL string
+
+	// Secret signs the request bodies, see WebhookSignatureHeader.
+	// Default: none = unsigned
+	Secret []byte
+
+	// Retries is the number of retries of failed deliveries, i.e. errors
+	// and non-2xx responses.
+	// Default: 3, negative values disable retries
+	Retries int
+
+	// RetryDelay is the delay before the first retry, doubled on each retry
+	// Default: 100ms
+	RetryDelay time.Duration
+
+	// Client sends the requests
+	// Default: http.DefaultClient
+	Client *http.Client
+}
+
+// WebhookEvent is the body of webhook requests
+type WebhookEvent struct {
+	Event    string            `json:"event"`
+	Key      string            `json:"key"`
+	Owner    string            `json:"owner,omitempty"`
+	Metadata map[string]string `json:"meta,omitempty"`
+	At       time.Time         `json:"at"`
+}
+
+// SignWebhook returns the signature of a webhook body, for verification
+// by receivers
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhook posts the event of a state transition, if any
+func (l *Locker) webhook(from, to State) {
+	if l.opts.Webhook == nil {
+		return
+	}
+
+	event := WebhookEvent{Key: l.key, Owner: l.opts.OwnerID, Metadata: l.meta, At: time.Now()}
+	switch {
+	case to == Held && from != Refreshing:
+		event.Event = WebhookAcquired
+	case to == Released:
+		event.Event = WebhookReleased
+	case to == Lost:
+		event.Event = WebhookStolen
+	default:
+		return
+	}
+
+	hook := l.opts.Webhook
+	go func() {
+		if event.Event == WebhookStolen {
+			if err := eval(l.client, luaGet, []string{l.key}).Err(); err == redis.Nil {
+				event.Event = WebhookExpired
+			}
+		}
+		_ = hook.deliver(&event)
+	}()
+}
+
+// deliver posts the event, with retries
+func (h *Webhook) deliver(event *WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	retries := h.Retries
+	if retries == 0 {
+		retries = 3
+	}
+	delay := h.RetryDelay
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err = h.post(client, body); err == nil || attempt >= retries {
+			return err
+		}
+		time.Sleep(delay << uint(attempt))
+	}
+}
+
+func (h *Webhook) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.Secret) != 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(h.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}